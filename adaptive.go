@@ -0,0 +1,88 @@
+package main
+
+import (
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Reasons for which a sub-collector is skipped
+const (
+	skipReasonDeadline         = "deadline"
+	skipReasonExpectedDuration = "expected_duration"
+)
+
+// expectedDurationDecay is the share of its expected duration a sub-collector keeps at every scrape,
+// so that one slow run stops weighing once the following runs are fast again
+const expectedDurationDecay = 0.9
+
+// collectorDurations remembers how long the sub-collectors take and how often they were skipped
+type collectorDurations struct {
+	mu       sync.Mutex
+	expected map[string]time.Duration
+	skips    map[[2]string]uint64
+}
+
+// newCollectorDurations creates a tracker without any history
+func newCollectorDurations() *collectorDurations {
+	return &collectorDurations{
+		expected: make(map[string]time.Duration),
+		skips:    make(map[[2]string]uint64),
+	}
+}
+
+// expectedDuration returns the longest recent duration of a sub-collector, zero before its first run
+func (d *collectorDurations) expectedDuration(name string) time.Duration {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.expected[name]
+}
+
+// observe records the runs and skips of a scrape
+// A skipped sub-collector decays as well, so it is tried again after a few scrapes
+func (d *collectorDurations) observe(s *scrape) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	for name, expected := range d.expected {
+		d.expected[name] = time.Duration(float64(expected) * expectedDurationDecay)
+	}
+	for _, run := range s.collectors {
+		duration := time.Duration(run.DurationSeconds * float64(time.Second))
+		d.expected[run.Name] = max(d.expected[run.Name], duration)
+	}
+	for _, name := range s.skipped {
+		d.skips[[2]string{name, skipReasonDeadline}]++
+	}
+	for _, name := range s.shed {
+		d.skips[[2]string{name, skipReasonExpectedDuration}]++
+	}
+}
+
+// collect sends the number of skips of every sub-collector by reason
+// Only optional sub-collectors are skipped for their expected duration
+func (d *collectorDurations) collect(ch chan<- prometheus.Metric, desc *metricDesc, collectors []subCollector) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	for _, sc := range collectors {
+		desc.counter(ch, float64(d.skips[[2]string{sc.name, skipReasonDeadline}]), sc.name, skipReasonDeadline)
+		if sc.optional {
+			desc.counter(ch, float64(d.skips[[2]string{sc.name, skipReasonExpectedDuration}]), sc.name, skipReasonExpectedDuration)
+		}
+	}
+}
+
+// shouldShed reports whether an optional sub-collector is expected to take longer than the time left in the scrape
+func (c *DockerSwarmCollector) shouldShed(s *scrape, sc subCollector) bool {
+	if !sc.optional || !c.options.AdaptiveSkip {
+		return false
+	}
+	expected := c.durations.expectedDuration(sc.name)
+	if budget := c.budget(sc.name); budget > 0 {
+		expected = min(expected, budget)
+	}
+	left, ok := s.timeLeft()
+	return ok && expected > 0 && left-c.options.DeadlineMargin < expected
+}
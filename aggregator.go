@@ -0,0 +1,136 @@
+package main
+
+import (
+	"context"
+	"log"
+	"net"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// agent is an exporter instance found through the swarm DNS
+type agent struct {
+	address   string
+	reachable bool
+}
+
+// aggregator discovers the agent instances of the exporter service
+type aggregator struct {
+	name     string
+	port     int
+	interval time.Duration
+	timeout  time.Duration
+
+	mu     sync.Mutex
+	agents []agent
+
+	discovered  *prometheus.Desc
+	unreachable *prometheus.Desc
+}
+
+// newAggregator creates an aggregator resolving the given name, usually tasks.<exporter-service>
+// The families follow the metric names and the cluster labels of the collector
+func newAggregator(collector *DockerSwarmCollector, name string, port int, interval, timeout time.Duration) *aggregator {
+	return &aggregator{
+		name:     name,
+		port:     port,
+		interval: interval,
+		timeout:  timeout,
+		discovered: prometheus.NewDesc(
+			collector.metricName("docker_exporter_agents_discovered"),
+			"The number of agent instances found through the swarm DNS",
+			nil, collector.clusterLabels(),
+		),
+		unreachable: prometheus.NewDesc(
+			collector.metricName("docker_exporter_agents_unreachable"),
+			"The number of discovered agent instances that did not accept a connection",
+			nil, collector.clusterLabels(),
+		),
+	}
+}
+
+// run discovers the agents until the context is canceled
+func (a *aggregator) run(ctx context.Context) {
+	ticker := time.NewTicker(a.interval)
+	defer ticker.Stop()
+
+	for {
+		a.discover(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// discover resolves the agent addresses and checks that each one accepts connections
+func (a *aggregator) discover(ctx context.Context) {
+	ctx, cancel := context.WithTimeout(ctx, a.timeout)
+	defer cancel()
+
+	addrs, err := net.DefaultResolver.LookupHost(ctx, a.name)
+	if err != nil {
+		// Keep the previous agents, a failed lookup is not a scale down
+		log.Printf("Error resolving agents %s: %v", a.name, err)
+		return
+	}
+	sort.Strings(addrs)
+
+	agents := make([]agent, len(addrs))
+	var wg sync.WaitGroup
+	for i, addr := range addrs {
+		agents[i].address = net.JoinHostPort(addr, strconv.Itoa(a.port))
+		wg.Add(1)
+		go func(agent *agent) {
+			defer wg.Done()
+			var dialer net.Dialer
+			conn, err := dialer.DialContext(ctx, "tcp", agent.address)
+			if err != nil {
+				return
+			}
+			conn.Close()
+			agent.reachable = true
+		}(&agents[i])
+	}
+	wg.Wait()
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if len(agents) != len(a.agents) {
+		log.Printf("Discovered %d agents, previously %d", len(agents), len(a.agents))
+	}
+	a.agents = agents
+}
+
+// current returns the agents found by the last successful discovery
+func (a *aggregator) current() []agent {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.agents
+}
+
+// Describe implements the prometheus.Collector interface
+func (a *aggregator) Describe(ch chan<- *prometheus.Desc) {
+	ch <- a.discovered
+	ch <- a.unreachable
+}
+
+// Collect implements the prometheus.Collector interface
+func (a *aggregator) Collect(ch chan<- prometheus.Metric) {
+	agents := a.current()
+
+	var unreachable int
+	for _, agent := range agents {
+		if !agent.reachable {
+			unreachable++
+		}
+	}
+
+	ch <- prometheus.MustNewConstMetric(a.discovered, prometheus.GaugeValue, float64(len(agents)))
+	ch <- prometheus.MustNewConstMetric(a.unreachable, prometheus.GaugeValue, float64(unreachable))
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ruleFile is a Prometheus rule file
+type ruleFile struct {
+	Groups []ruleGroup `yaml:"groups"`
+}
+
+// ruleGroup is a named group of Prometheus rules
+type ruleGroup struct {
+	Name  string         `yaml:"name"`
+	Rules []alertingRule `yaml:"rules"`
+}
+
+// alertingRule is a Prometheus alerting rule
+type alertingRule struct {
+	Alert       string            `yaml:"alert"`
+	Expr        string            `yaml:"expr"`
+	For         string            `yaml:"for,omitempty"`
+	Labels      map[string]string `yaml:"labels,omitempty"`
+	Annotations map[string]string `yaml:"annotations,omitempty"`
+}
+
+// alertParams holds the query parameters of the alerting rules endpoint
+type alertParams struct {
+	severity         string
+	criticalSeverity string
+	replicaDriftFor  time.Duration
+	nodeDownFor      time.Duration
+	quorumRiskFor    time.Duration
+	updateStuckFor   time.Duration
+}
+
+// parseAlertParams reads the query parameters, falling back to the defaults
+func parseAlertParams(r *http.Request) (alertParams, error) {
+	query := r.URL.Query()
+	p := alertParams{
+		severity:         "warning",
+		criticalSeverity: "critical",
+		replicaDriftFor:  10 * time.Minute,
+		nodeDownFor:      5 * time.Minute,
+		quorumRiskFor:    time.Minute,
+		updateStuckFor:   30 * time.Minute,
+	}
+	if value := query.Get("severity"); value != "" {
+		p.severity = value
+	}
+	if value := query.Get("critical_severity"); value != "" {
+		p.criticalSeverity = value
+	}
+
+	durations := map[string]*time.Duration{
+		"replica_drift_for": &p.replicaDriftFor,
+		"node_down_for":     &p.nodeDownFor,
+		"quorum_risk_for":   &p.quorumRiskFor,
+		"update_stuck_for":  &p.updateStuckFor,
+	}
+	for name, target := range durations {
+		value := query.Get(name)
+		if value == "" {
+			continue
+		}
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return p, fmt.Errorf("invalid %s: %w", name, err)
+		}
+		*target = d
+	}
+	return p, nil
+}
+
+// promDuration formats a duration the way Prometheus rule files expect
+func promDuration(d time.Duration) string {
+	if d%time.Hour == 0 {
+		return fmt.Sprintf("%dh", d/time.Hour)
+	}
+	if d%time.Minute == 0 {
+		return fmt.Sprintf("%dm", d/time.Minute)
+	}
+	return fmt.Sprintf("%ds", d/time.Second)
+}
+
+// alertingRules generates the alerting rules from the metric names of the collector
+func (c *DockerSwarmCollector) alertingRules(p alertParams) ruleFile {
+	return ruleFile{Groups: []ruleGroup{{
+		Name: "docker-swarm",
+		Rules: []alertingRule{
+			{
+				Alert:  "DockerSwarmServiceReplicaDrift",
+				Expr:   fmt.Sprintf("%s < %s", c.tasksRunning.name, c.tasksDesired.name),
+				For:    promDuration(p.replicaDriftFor),
+				Labels: map[string]string{"severity": p.severity},
+				Annotations: map[string]string{
+					"summary":     "Service {{ $labels.service_name }} runs fewer tasks than desired",
+					"description": "{{ $value }} tasks of service {{ $labels.service_name }} are running, fewer than desired for " + promDuration(p.replicaDriftFor) + ".",
+				},
+			},
+			{
+				Alert:  "DockerSwarmNodeDown",
+				Expr:   fmt.Sprintf("%s < %s", c.nodesActive.name, c.nodesCount.name),
+				For:    promDuration(p.nodeDownFor),
+				Labels: map[string]string{"severity": p.severity},
+				Annotations: map[string]string{
+					"summary":     "Swarm nodes are down",
+					"description": "Only {{ $value }} swarm nodes are ready.",
+				},
+			},
+			{
+				Alert: "DockerSwarmManagerQuorumRisk",
+				// One more manager failure would lose the raft quorum
+				Expr:   fmt.Sprintf("%s <= floor(%s / 2) + 1 and %s > 1", c.managersReachable.name, c.managersCount.name, c.managersCount.name),
+				For:    promDuration(p.quorumRiskFor),
+				Labels: map[string]string{"severity": p.criticalSeverity},
+				Annotations: map[string]string{
+					"summary":     "Swarm managers are one failure away from losing quorum",
+					"description": "Only {{ $value }} swarm managers are reachable.",
+				},
+			},
+			{
+				Alert:  "DockerSwarmServiceUpdateStuck",
+				Expr:   fmt.Sprintf(`%s{state=~"updating|rollback_started"} == 1`, c.serviceUpdateState.name),
+				For:    promDuration(p.updateStuckFor),
+				Labels: map[string]string{"severity": p.severity},
+				Annotations: map[string]string{
+					"summary":     "Update of service {{ $labels.service_name }} is stuck",
+					"description": "Service {{ $labels.service_name }} has been in state {{ $labels.state }} for more than " + promDuration(p.updateStuckFor) + ".",
+				},
+			},
+		},
+	}}}
+}
+
+// alertsHandler serves alerting rules for the metrics of the collector
+func (c *DockerSwarmCollector) alertsHandler(w http.ResponseWriter, r *http.Request) {
+	p, err := parseAlertParams(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/yaml")
+	encoder := yaml.NewEncoder(w)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(c.alertingRules(p)); err != nil {
+		log.Printf("Error writing alerting rules: %v", err)
+	}
+}
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// apiServices is the response of the services API
+type apiServices struct {
+	Collected time.Time     `json:"collected"`
+	Services  []serviceView `json:"services"`
+}
+
+// apiNodes is the response of the nodes API
+type apiNodes struct {
+	Collected time.Time  `json:"collected"`
+	Nodes     []nodeView `json:"nodes"`
+}
+
+// apiTasks is the response of the tasks API, one page of the matching tasks
+type apiTasks struct {
+	Collected time.Time  `json:"collected"`
+	Total     int        `json:"total"`
+	Offset    int        `json:"offset"`
+	Limit     int        `json:"limit"`
+	Tasks     []taskView `json:"tasks"`
+}
+
+// Page sizes of the tasks API
+const (
+	apiTasksDefaultLimit = 100
+	apiTasksMaxLimit     = 1000
+)
+
+// writeJSON writes an API response
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(v); err != nil {
+		log.Printf("Error writing API response: %v", err)
+	}
+}
+
+// apiSnapshot returns the last collection snapshot, answering with an error when there is none yet
+func (c *DockerSwarmCollector) apiSnapshot(w http.ResponseWriter) *snapshot {
+	snap := c.latestSnapshot()
+	if snap == nil {
+		http.Error(w, "no successful collection yet", http.StatusServiceUnavailable)
+	}
+	return snap
+}
+
+// servicesAPIHandler lists the services of the last collection, filtered by the
+// stack, name, mode, update_state and converged query parameters
+func (c *DockerSwarmCollector) servicesAPIHandler(w http.ResponseWriter, r *http.Request) {
+	snap := c.apiSnapshot(w)
+	if snap == nil {
+		return
+	}
+
+	query := r.URL.Query()
+	var converged *bool
+	if value := query.Get("converged"); value != "" {
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			http.Error(w, "invalid converged parameter", http.StatusBadRequest)
+			return
+		}
+		converged = &b
+	}
+
+	response := apiServices{Collected: snap.Taken, Services: []serviceView{}}
+	for _, service := range snap.services() {
+		if !matchesParam(query.Get("stack"), service.Stack) ||
+			!matchesParam(query.Get("name"), service.Name) ||
+			!matchesParam(query.Get("mode"), service.Mode) ||
+			!matchesParam(query.Get("update_state"), service.UpdateState) {
+			continue
+		}
+		if converged != nil && service.Converged != *converged {
+			continue
+		}
+		response.Services = append(response.Services, service)
+	}
+	writeJSON(w, response)
+}
+
+// nodesAPIHandler lists the nodes of the last collection, filtered by the
+// role, availability and state query parameters
+func (c *DockerSwarmCollector) nodesAPIHandler(w http.ResponseWriter, r *http.Request) {
+	snap := c.apiSnapshot(w)
+	if snap == nil {
+		return
+	}
+
+	query := r.URL.Query()
+	response := apiNodes{Collected: snap.Taken, Nodes: []nodeView{}}
+	for _, node := range snap.nodes() {
+		if !matchesParam(query.Get("role"), node.Role) ||
+			!matchesParam(query.Get("availability"), node.Availability) ||
+			!matchesParam(query.Get("state"), node.State) {
+			continue
+		}
+		response.Nodes = append(response.Nodes, node)
+	}
+	writeJSON(w, response)
+}
+
+// tasksAPIHandler lists the tasks of the last collection, most recent first, filtered by the
+// service, node, state, desired_state and slot query parameters and paginated by limit and offset
+func (c *DockerSwarmCollector) tasksAPIHandler(w http.ResponseWriter, r *http.Request) {
+	snap := c.apiSnapshot(w)
+	if snap == nil {
+		return
+	}
+	if !snap.HasTasks {
+		http.Error(w, "tasks were not listed by the last collection", http.StatusServiceUnavailable)
+		return
+	}
+
+	query := r.URL.Query()
+	limit, err := intParam(query.Get("limit"), apiTasksDefaultLimit)
+	if err != nil || limit < 1 {
+		http.Error(w, "invalid limit parameter", http.StatusBadRequest)
+		return
+	}
+	if limit > apiTasksMaxLimit {
+		limit = apiTasksMaxLimit
+	}
+	offset, err := intParam(query.Get("offset"), 0)
+	if err != nil || offset < 0 {
+		http.Error(w, "invalid offset parameter", http.StatusBadRequest)
+		return
+	}
+	slot := query.Get("slot")
+
+	var matching []taskView
+	for _, task := range snap.tasks() {
+		// Services and nodes can be selected by ID or by name
+		if !matchesParam(query.Get("service"), task.ServiceID) && !matchesParam(query.Get("service"), task.ServiceName) {
+			continue
+		}
+		if !matchesParam(query.Get("node"), task.NodeID) && !matchesParam(query.Get("node"), task.NodeHostname) {
+			continue
+		}
+		if !matchesParam(query.Get("state"), task.State) ||
+			!matchesParam(query.Get("desired_state"), task.DesiredState) ||
+			!matchesParam(slot, strconv.Itoa(task.Slot)) {
+			continue
+		}
+		matching = append(matching, task)
+	}
+
+	response := apiTasks{
+		Collected: snap.Taken,
+		Total:     len(matching),
+		Offset:    offset,
+		Limit:     limit,
+		Tasks:     []taskView{},
+	}
+	if offset < len(matching) {
+		end := min(offset+limit, len(matching))
+		response.Tasks = matching[offset:end]
+	}
+	writeJSON(w, response)
+}
+
+// intParam parses an integer query parameter, returning the default when it is empty
+func intParam(value string, def int) (int, error) {
+	if value == "" {
+		return def, nil
+	}
+	return strconv.Atoi(value)
+}
+
+// matchesParam reports whether a value is selected by a query parameter, an empty parameter selecting everything
+func matchesParam(param, value string) bool {
+	return param == "" || param == value
+}
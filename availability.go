@@ -0,0 +1,177 @@
+package main
+
+import (
+	"maps"
+	"slices"
+	"sync"
+	"time"
+)
+
+// availabilityWindows are the rolling windows of docker_service_availability_ratio
+var availabilityWindows = []struct {
+	name     string
+	duration time.Duration
+}{
+	{"5m", 5 * time.Minute},
+	{"1h", time.Hour},
+}
+
+// availabilitySample records whether a service ran every desired task at a scrape
+type availabilitySample struct {
+	at        time.Time
+	available bool
+}
+
+// availabilityTracker keeps the availability samples of every service across scrapes
+type availabilityTracker struct {
+	mu      sync.Mutex
+	samples map[string][]availabilitySample
+	window  time.Duration
+}
+
+// newAvailabilityTracker creates a tracker keeping enough samples for the longest window
+func newAvailabilityTracker() *availabilityTracker {
+	t := &availabilityTracker{samples: make(map[string][]availabilitySample)}
+	for _, w := range availabilityWindows {
+		t.window = max(t.window, w.duration)
+	}
+	return t
+}
+
+// clone returns a copy of the tracker sharing no state with it
+func (t *availabilityTracker) clone() *availabilityTracker {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	c := &availabilityTracker{samples: make(map[string][]availabilitySample, len(t.samples)), window: t.window}
+	for service, samples := range t.samples {
+		c.samples[service] = slices.Clone(samples)
+	}
+	return c
+}
+
+// observe records the availability of a service and returns its ratio over every window
+func (t *availabilityTracker) observe(service string, at time.Time, available bool) []float64 {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	samples := append(t.samples[service], availabilitySample{at: at, available: available})
+
+	// Keep the last sample before the longest window, it holds the state at its start
+	cutoff := at.Add(-t.window)
+	first := 0
+	for first+1 < len(samples) && !samples[first+1].at.After(cutoff) {
+		first++
+	}
+	samples = samples[first:]
+	t.samples[service] = samples
+
+	ratios := make([]float64, len(availabilityWindows))
+	for i, w := range availabilityWindows {
+		ratios[i] = availabilityRatio(samples, at, w.duration)
+	}
+	return ratios
+}
+
+// prune forgets the services not observed within the longest window
+func (t *availabilityTracker) prune(now time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for service, samples := range t.samples {
+		if now.Sub(samples[len(samples)-1].at) > t.window {
+			delete(t.samples, service)
+		}
+	}
+}
+
+// availabilityRatio returns the fraction of the observed part of the window during which
+// the service was available, each sample holding until the next one
+func availabilityRatio(samples []availabilitySample, now time.Time, window time.Duration) float64 {
+	start := now.Add(-window)
+
+	var total, available time.Duration
+	for i, sample := range samples {
+		from := sample.at
+		if from.Before(start) {
+			from = start
+		}
+		to := now
+		if i+1 < len(samples) {
+			to = samples[i+1].at
+		}
+		if !to.After(from) {
+			continue
+		}
+		total += to.Sub(from)
+		if sample.available {
+			available += to.Sub(from)
+		}
+	}
+
+	// A single sample covers no time yet
+	if total == 0 {
+		if samples[len(samples)-1].available {
+			return 1
+		}
+		return 0
+	}
+	return float64(available) / float64(total)
+}
+
+// outageTrackerRetention is how long a service that is no longer observed is remembered
+const outageTrackerRetention = time.Hour
+
+// serviceOutage records the last time a service was observed without any running task
+type serviceOutage struct {
+	lastZero time.Time
+	seen     time.Time
+}
+
+// outageTracker keeps the last total outage of every service across scrapes
+type outageTracker struct {
+	mu       sync.Mutex
+	services map[string]serviceOutage
+}
+
+// newOutageTracker creates an empty tracker
+func newOutageTracker() *outageTracker {
+	return &outageTracker{services: make(map[string]serviceOutage)}
+}
+
+// clone returns a copy of the tracker sharing no state with it
+func (t *outageTracker) clone() *outageTracker {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return &outageTracker{services: maps.Clone(t.services)}
+}
+
+// observe records the running tasks of a service and returns the last time it ran none,
+// its creation time when no outage was observed since the exporter started
+func (t *outageTracker) observe(service string, at, created time.Time, running, desired uint64) time.Time {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	outage, ok := t.services[service]
+	if !ok {
+		outage.lastZero = created
+	}
+	// A service scaled to zero is not down
+	if running == 0 && desired > 0 {
+		outage.lastZero = at
+	}
+	outage.seen = at
+	t.services[service] = outage
+	return outage.lastZero
+}
+
+// prune forgets the services not observed for a while
+func (t *outageTracker) prune(now time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for service, outage := range t.services {
+		if now.Sub(outage.seen) > outageTrackerRetention {
+			delete(t.services, service)
+		}
+	}
+}
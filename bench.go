@@ -0,0 +1,263 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"runtime"
+	"sort"
+	"text/tabwriter"
+	"time"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/network"
+	"github.com/docker/docker/api/types/swarm"
+	"github.com/docker/docker/api/types/system"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/expfmt"
+)
+
+// runBench runs a bench subcommand
+func runBench(args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("usage: bench synth|live [flags]")
+	}
+
+	switch args[0] {
+	case "synth":
+		return benchSynth(args[1:])
+	case "live":
+		return benchLive(args[1:])
+	default:
+		return fmt.Errorf("unknown bench subcommand %q", args[0])
+	}
+}
+
+// benchSynth measures collections against a generated cluster
+func benchSynth(args []string) error {
+	fs := flag.NewFlagSet("bench synth", flag.ExitOnError)
+	nodes := fs.Int("nodes", 50, "Number of nodes of the generated cluster.")
+	services := fs.Int("services", 500, "Number of services of the generated cluster.")
+	tasks := fs.Int("tasks", 5000, "Number of tasks of the generated cluster, spread over the services.")
+	iterations := fs.Int("iterations", 20, "Number of collections to measure.")
+	fs.Parse(args)
+
+	if *nodes < 1 || *services < 1 || *tasks < 0 || *iterations < 1 {
+		return fmt.Errorf("nodes, services and iterations must be positive")
+	}
+
+	state := synthState(*nodes, *services, *tasks)
+	collector := NewDockerSwarmCollector(staticDocker{state: state}, CollectorOptions{
+		Timeout:      time.Minute,
+		FailureMode:  failureModeDrop,
+		ClusterID:    state.clusterID(),
+		SwarmManager: true,
+	})
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(collector)
+
+	fmt.Printf("Cluster: %d nodes, %d services, %d tasks\n", *nodes, *services, *tasks)
+
+	durations := make([]time.Duration, *iterations)
+	var allocs, allocBytes uint64
+	var series, size int
+	for i := range durations {
+		var before, after runtime.MemStats
+		runtime.ReadMemStats(&before)
+		start := time.Now()
+
+		families, err := registry.Gather()
+		if err != nil {
+			return err
+		}
+
+		durations[i] = time.Since(start)
+		runtime.ReadMemStats(&after)
+		allocs += after.Mallocs - before.Mallocs
+		allocBytes += after.TotalAlloc - before.TotalAlloc
+
+		series = 0
+		for _, family := range families {
+			series += len(family.Metric)
+		}
+		out := &countingWriter{}
+		encoder := expfmt.NewEncoder(out, expfmt.NewFormat(expfmt.TypeTextPlain))
+		for _, family := range families {
+			if err := encoder.Encode(family); err != nil {
+				return err
+			}
+		}
+		size = out.n
+	}
+
+	fmt.Printf("Collection: p50 %s, p90 %s, max %s over %d iterations\n",
+		percentile(durations, 0.5), percentile(durations, 0.9), percentile(durations, 1), *iterations)
+	fmt.Printf("Allocations: %d allocs/op, %d B/op\n", allocs/uint64(*iterations), allocBytes/uint64(*iterations))
+	fmt.Printf("Output: %d series, %d bytes\n", series, size)
+	return nil
+}
+
+// benchLive measures repeated collections against a live daemon, per Docker API call and per sub-collector
+func benchLive(args []string) error {
+	fs := flag.NewFlagSet("bench live", flag.ExitOnError)
+	socket := fs.String("docker.socket", *dockerSocket, "Docker socket path.")
+	timeout := fs.Duration("scrape.timeout", *scrapeTimeout, "Timeout for each collection.")
+	iterations := fs.Int("iterations", 20, "Number of collections to measure.")
+	fs.Parse(args)
+
+	if *iterations < 1 {
+		return fmt.Errorf("iterations must be positive")
+	}
+
+	dockerClient, err := newDockerClient(*socket, nil, tlsSettings{})
+	if err != nil {
+		return fmt.Errorf("creating Docker client: %w", err)
+	}
+	defer dockerClient.Close()
+
+	clusterID, manager, err := swarmIdentity(dockerClient)
+	if err != nil {
+		return fmt.Errorf("getting Docker info: %w", err)
+	}
+	collector := NewDockerSwarmCollector(dockerClient, CollectorOptions{
+		Timeout:      *timeout,
+		FailureMode:  failureModeDrop,
+		ClusterID:    clusterID,
+		SwarmManager: manager,
+	})
+
+	var scrapes []time.Duration
+	var failed int
+	calls := make(map[string][]time.Duration)
+	collectors := make(map[string][]time.Duration)
+	for i := 0; i < *iterations; i++ {
+		ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+		s := newScrape(ctx, collector.docker)
+		collector.collect(s)
+		s.finish()
+		cancel()
+
+		scrapes = append(scrapes, time.Since(s.started))
+		if s.failed() {
+			failed++
+		}
+		for _, call := range s.calls {
+			calls[call.Call] = append(calls[call.Call], secondsDuration(call.DurationSeconds))
+		}
+		for _, run := range s.collectors {
+			collectors[run.Name] = append(collectors[run.Name], secondsDuration(run.DurationSeconds))
+		}
+	}
+
+	fmt.Printf("%d collections, %d failed\n\n", *iterations, failed)
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "NAME\tCOUNT\tP50\tP90\tP99\tMAX")
+	printPercentiles(w, "scrape", scrapes)
+	for _, name := range sortedKeys(collectors) {
+		printPercentiles(w, "collector "+name, collectors[name])
+	}
+	for _, name := range sortedKeys(calls) {
+		printPercentiles(w, "call "+name, calls[name])
+	}
+	return w.Flush()
+}
+
+// printPercentiles writes a table row with the latency percentiles of the durations
+func printPercentiles(w io.Writer, name string, durations []time.Duration) {
+	fmt.Fprintf(w, "%s\t%d\t%s\t%s\t%s\t%s\n", name, len(durations),
+		percentile(durations, 0.5).Round(time.Microsecond),
+		percentile(durations, 0.9).Round(time.Microsecond),
+		percentile(durations, 0.99).Round(time.Microsecond),
+		percentile(durations, 1).Round(time.Microsecond))
+}
+
+// secondsDuration converts a number of seconds of the scrape trace to a duration
+func secondsDuration(seconds float64) time.Duration {
+	return time.Duration(seconds * float64(time.Second))
+}
+
+// synthState generates a swarm of the given size, the local daemon being the first node
+func synthState(nodes, services, tasks int) *dockerState {
+	state := &dockerState{
+		Created: time.Now().UTC(),
+		Version: Version,
+		Info: system.Info{
+			Name: "node-0",
+			Swarm: swarm.Info{
+				NodeID:           "node-0",
+				LocalNodeState:   swarm.LocalNodeStateActive,
+				ControlAvailable: true,
+				Cluster:          &swarm.ClusterInfo{ID: "synth"},
+			},
+		},
+		Networks: []network.Summary{
+			{ID: "ingress", Name: "ingress", Driver: "overlay"},
+			{ID: "bridge", Name: "bridge", Driver: "bridge"},
+		},
+	}
+
+	for i := 0; i < nodes; i++ {
+		state.Nodes = append(state.Nodes, swarm.Node{
+			ID:          fmt.Sprintf("node-%d", i),
+			Description: swarm.NodeDescription{Hostname: fmt.Sprintf("node-%d", i)},
+			Status:      swarm.NodeStatus{State: swarm.NodeStateReady},
+		})
+	}
+
+	replicas := uint64(tasks / services)
+	for i := 0; i < services; i++ {
+		service := swarm.Service{ID: fmt.Sprintf("service-%d", i)}
+		service.Spec.Name = fmt.Sprintf("stack-%d_service-%d", i%20, i)
+		service.Spec.Labels = map[string]string{stackNamespaceLabel: fmt.Sprintf("stack-%d", i%20)}
+		service.Spec.Mode.Replicated = &swarm.ReplicatedService{Replicas: &replicas}
+		service.Endpoint.Ports = []swarm.PortConfig{{
+			Protocol:      swarm.PortConfigProtocolTCP,
+			TargetPort:    8080,
+			PublishedPort: uint32(30000 + i),
+			PublishMode:   swarm.PortConfigPublishModeIngress,
+		}}
+		state.Services = append(state.Services, service)
+	}
+
+	for i := 0; i < tasks; i++ {
+		nodeID := state.Nodes[i%nodes].ID
+		state.Tasks = append(state.Tasks, swarm.Task{
+			ID:           fmt.Sprintf("task-%d", i),
+			ServiceID:    state.Services[i%services].ID,
+			NodeID:       nodeID,
+			DesiredState: swarm.TaskStateRunning,
+			Status:       swarm.TaskStatus{State: swarm.TaskStateRunning},
+		})
+		if nodeID == state.Info.Swarm.NodeID {
+			state.Containers = append(state.Containers, container.Summary{ID: fmt.Sprintf("container-%d", i), State: "running"})
+		}
+	}
+	return state
+}
+
+// percentile returns the duration below which the given fraction of the durations fall
+func percentile(durations []time.Duration, p float64) time.Duration {
+	sorted := append([]time.Duration(nil), durations...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	i := int(p*float64(len(sorted))+0.5) - 1
+	if i < 0 {
+		i = 0
+	}
+	if i >= len(sorted) {
+		i = len(sorted) - 1
+	}
+	return sorted[i]
+}
+
+// countingWriter counts the bytes written to it
+type countingWriter struct {
+	n int
+}
+
+// Write implements the io.Writer interface
+func (w *countingWriter) Write(p []byte) (int, error) {
+	w.n += len(p)
+	return len(p), nil
+}
@@ -0,0 +1,204 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/docker/go-connections/tlsconfig"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+)
+
+// nodeInfoFamily identifies the node of an agent in its metrics
+const nodeInfoFamily = "docker_exporter_node_info"
+
+// clusterGatherer merges the swarm metrics of this instance with the per-node metrics of the agents
+type clusterGatherer struct {
+	local   prometheus.Gatherer
+	agg     *aggregator
+	path    string
+	token   string
+	timeout time.Duration
+
+	// scheme and client fetch the metrics of the agents, over HTTPS when they serve TLS
+	scheme string
+	client *http.Client
+
+	// nodeInfo is the name of the family identifying the node of an agent, which the agents share with this instance
+	nodeInfo string
+
+	// nodeFamilies are the families describing a single node, taken from the agents
+	nodeFamilies map[string]bool
+}
+
+// agentMetrics holds the per-node metric families of one agent
+type agentMetrics struct {
+	address  string
+	nodeID   string
+	families []*dto.MetricFamily
+	err      error
+}
+
+// newClusterGatherer creates a gatherer serving the per-node families of the collector from the agents
+func newClusterGatherer(local prometheus.Gatherer, c *DockerSwarmCollector, agg *aggregator, path, token string, timeout time.Duration, scheme string, client *http.Client) *clusterGatherer {
+	return &clusterGatherer{
+		local:        local,
+		agg:          agg,
+		path:         path,
+		token:        token,
+		timeout:      timeout,
+		scheme:       scheme,
+		client:       client,
+		nodeInfo:     c.metricName(nodeInfoFamily),
+		nodeFamilies: c.familyNames(false),
+	}
+}
+
+// newAgentClient creates the HTTPS client of the agents, verifying their certificates against a CA file, the system
+// roots without one, and against a server name rather than the address of each agent when given
+func newAgentClient(caFile, serverName string, settings tlsSettings) (*http.Client, error) {
+	config, err := tlsconfig.Client(tlsconfig.Options{CAFile: caFile, ExclusiveRootPools: caFile != ""})
+	if err != nil {
+		return nil, fmt.Errorf("loading agent TLS files: %w", err)
+	}
+	config.ServerName = serverName
+	settings.apply(config)
+	return &http.Client{Transport: &http.Transport{TLSClientConfig: config}}, nil
+}
+
+// Gather implements the prometheus.Gatherer interface
+func (g *clusterGatherer) Gather() ([]*dto.MetricFamily, error) {
+	local, err := g.local.Gather()
+	if err != nil {
+		log.Printf("Error gathering local metrics: %v", err)
+	}
+
+	// This instance only contributes the families about the swarm and itself
+	families := make([]*dto.MetricFamily, 0, len(local))
+	for _, family := range local {
+		if !g.nodeFamilies[family.GetName()] {
+			families = append(families, family)
+		}
+	}
+
+	// When several agents report the same node, e.g. during an update of the
+	// exporter service, the first one in address order wins
+	seen := make(map[string]string)
+	for _, agent := range g.scrapeAgents() {
+		if agent.err != nil {
+			log.Printf("Error scraping agent %s: %v", agent.address, agent.err)
+			continue
+		}
+		if other, ok := seen[agent.nodeID]; ok {
+			log.Printf("Ignoring agent %s, node %s is already reported by %s", agent.address, agent.nodeID, other)
+			continue
+		}
+		seen[agent.nodeID] = agent.address
+		families = append(families, agent.families...)
+	}
+
+	return prometheus.Gatherers{prometheus.GathererFunc(func() ([]*dto.MetricFamily, error) {
+		return families, nil
+	})}.Gather()
+}
+
+// scrapeAgents fetches the per-node metrics of every discovered agent concurrently
+func (g *clusterGatherer) scrapeAgents() []agentMetrics {
+	ctx, cancel := context.WithTimeout(context.Background(), g.timeout)
+	defer cancel()
+
+	agents := g.agg.current()
+	results := make([]agentMetrics, len(agents))
+	var wg sync.WaitGroup
+	for i, agent := range agents {
+		results[i].address = agent.address
+		wg.Add(1)
+		go func(result *agentMetrics) {
+			defer wg.Done()
+			result.nodeID, result.families, result.err = g.scrapeAgent(ctx, result.address)
+		}(&results[i])
+	}
+	wg.Wait()
+	return results
+}
+
+// scrapeAgent fetches the metrics of an agent and labels its per-node families with its node
+func (g *clusterGatherer) scrapeAgent(ctx context.Context, address string) (string, []*dto.MetricFamily, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, g.scheme+"://"+address+g.path, nil)
+	if err != nil {
+		return "", nil, err
+	}
+	req.Header.Set("Accept", string(expfmt.NewFormat(expfmt.TypeProtoDelim)))
+	if g.token != "" {
+		req.Header.Set("Authorization", "Bearer "+g.token)
+	}
+
+	resp, err := g.client.Do(req)
+	if err != nil {
+		return "", nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", nil, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+
+	var families []*dto.MetricFamily
+	var nodeLabels []*dto.LabelPair
+	decoder := expfmt.NewDecoder(resp.Body, expfmt.ResponseFormat(resp.Header))
+	for {
+		family := &dto.MetricFamily{}
+		if err := decoder.Decode(family); err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			return "", nil, err
+		}
+		if !g.nodeFamilies[family.GetName()] {
+			continue
+		}
+		if family.GetName() == g.nodeInfo && len(family.Metric) > 0 {
+			nodeLabels = family.Metric[0].Label
+		}
+		families = append(families, family)
+	}
+
+	var nodeID string
+	for _, label := range nodeLabels {
+		if label.GetName() == "node_id" {
+			nodeID = label.GetValue()
+		}
+	}
+	if nodeID == "" {
+		return "", nil, fmt.Errorf("no %s metric with a node_id", g.nodeInfo)
+	}
+
+	for _, family := range families {
+		for _, metric := range family.Metric {
+			metric.Label = withLabels(metric.Label, nodeLabels)
+		}
+	}
+	return nodeID, families, nil
+}
+
+// withLabels adds the extra labels a metric does not already have, keeping the labels sorted
+func withLabels(labels, extra []*dto.LabelPair) []*dto.LabelPair {
+	present := make(map[string]bool, len(labels))
+	for _, label := range labels {
+		present[label.GetName()] = true
+	}
+	for _, label := range extra {
+		if !present[label.GetName()] {
+			labels = append(labels, label)
+		}
+	}
+	sort.Slice(labels, func(i, j int) bool { return labels[i].GetName() < labels[j].GetName() })
+	return labels
+}
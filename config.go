@@ -0,0 +1,116 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+
+	"github.com/prometheus/common/model"
+	"gopkg.in/yaml.v3"
+)
+
+// fileConfig is the configuration file given with --config.file
+type fileConfig struct {
+	// Clusters lists the swarms collected by this instance instead of the local daemon
+	Clusters []clusterConfig `yaml:"clusters"`
+
+	// Budgets gives sub-collectors a percentage of the scrape timeout they may not exceed
+	Budgets map[string]float64 `yaml:"budgets"`
+
+	// LogPatterns names the regular expressions counted in the service logs
+	LogPatterns map[string]string `yaml:"log_patterns"`
+
+	// MetricRelabelConfigs shape the exposed metrics like the metric_relabel_configs of Prometheus
+	MetricRelabelConfigs []relabelConfig `yaml:"metric_relabel_configs"`
+
+	// ServiceProbes checks that the published ports of services accept connections or answer HTTP requests
+	ServiceProbes []serviceProbeConfig `yaml:"service_probes"`
+
+	// Tenants assigns the services to the teams sharing the swarm, added as a label to their metrics
+	Tenants tenantConfig `yaml:"tenants"`
+
+	// DerivedMetrics are gauges computed from the collected metrics, like simple recording rules
+	DerivedMetrics []derivedConfig `yaml:"derived_metrics"`
+
+	// MetricNames exposes metric families under custom names, keyed by their names in the exporter
+	MetricNames map[string]string `yaml:"metric_names"`
+}
+
+// clusterConfig describes how to reach a manager of one swarm
+type clusterConfig struct {
+	Name string `yaml:"name"`
+	Host string `yaml:"host"`
+
+	// TLS files for managers exposing the Docker API over TCP
+	TLSCAFile   string `yaml:"tls_ca_file"`
+	TLSCertFile string `yaml:"tls_cert_file"`
+	TLSKeyFile  string `yaml:"tls_key_file"`
+}
+
+// loadConfig reads and validates the configuration file
+func loadConfig(path string) (*fileConfig, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var cfg fileConfig
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&cfg); err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", path, err)
+	}
+
+	names := make(map[string]bool)
+	for i, cluster := range cfg.Clusters {
+		if cluster.Name == "" {
+			return nil, fmt.Errorf("cluster %d has no name", i)
+		}
+		if names[cluster.Name] {
+			return nil, fmt.Errorf("duplicate cluster name %q", cluster.Name)
+		}
+		names[cluster.Name] = true
+		if cluster.Host == "" {
+			return nil, fmt.Errorf("cluster %q has no host", cluster.Name)
+		}
+		if (cluster.TLSCertFile == "") != (cluster.TLSKeyFile == "") {
+			return nil, fmt.Errorf("cluster %q needs both tls_cert_file and tls_key_file", cluster.Name)
+		}
+	}
+
+	var total float64
+	for name, percent := range cfg.Budgets {
+		if percent <= 0 || percent > 100 {
+			return nil, fmt.Errorf("budget of %s must be between 0 and 100 percent", name)
+		}
+		total += percent
+	}
+	if total > 100 {
+		return nil, fmt.Errorf("budgets add up to %g percent, more than 100", total)
+	}
+
+	probed := make(map[string]bool)
+	for i := range cfg.ServiceProbes {
+		probe := &cfg.ServiceProbes[i]
+		if err := probe.validate(); err != nil {
+			return nil, err
+		}
+		if probed[probe.Service] {
+			return nil, fmt.Errorf("duplicate service probe of %s", probe.Service)
+		}
+		probed[probe.Service] = true
+	}
+
+	renamed := make(map[string]string)
+	for _, name := range sortedKeys(cfg.MetricNames) {
+		custom := cfg.MetricNames[name]
+		if !model.IsValidLegacyMetricName(custom) {
+			return nil, fmt.Errorf("invalid metric name %q for %s", custom, name)
+		}
+		if previous, ok := renamed[custom]; ok {
+			return nil, fmt.Errorf("metrics %s and %s are both renamed to %s", previous, name, custom)
+		}
+		renamed[custom] = name
+	}
+	return &cfg, nil
+}
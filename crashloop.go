@@ -0,0 +1,144 @@
+package main
+
+import (
+	"maps"
+	"sync"
+	"time"
+
+	"github.com/docker/docker/api/types/swarm"
+)
+
+// serviceRestarts holds the tasks of a service that ended by themselves within the crash-loop window,
+// and counts the exit codes of the tasks whose container exited
+type serviceRestarts struct {
+	ended map[string]time.Time
+	seen  time.Time
+
+	// exited holds the listed tasks whose exit code was counted already
+	exited map[string]bool
+	exits  map[int]uint64
+}
+
+// restartStats are the restarts of a service within the crash-loop window and its exit codes since the exporter started
+type restartStats struct {
+	restarts int
+	exits    map[int]uint64
+}
+
+// restartTracker remembers the tasks that ended by themselves, which the swarm replaces,
+// so that restarts still count after the swarm pruned the tasks from its task history
+type restartTracker struct {
+	mu       sync.Mutex
+	services map[string]*serviceRestarts
+}
+
+// newRestartTracker creates an empty tracker
+func newRestartTracker() *restartTracker {
+	return &restartTracker{services: make(map[string]*serviceRestarts)}
+}
+
+// clone returns a copy of the tracker sharing no state with it
+func (t *restartTracker) clone() *restartTracker {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	c := newRestartTracker()
+	for service, r := range t.services {
+		c.services[service] = &serviceRestarts{ended: maps.Clone(r.ended), seen: r.seen, exited: maps.Clone(r.exited), exits: maps.Clone(r.exits)}
+	}
+	return c
+}
+
+// taskRestarted reports whether a task ended without being asked to: it failed, was rejected, or exited
+// successfully although its service is not a job
+func taskRestarted(service swarm.Service, task swarm.Task) bool {
+	switch task.Status.State {
+	case swarm.TaskStateFailed, swarm.TaskStateRejected:
+		return true
+	case swarm.TaskStateComplete:
+		return service.Spec.Mode.ReplicatedJob == nil && service.Spec.Mode.GlobalJob == nil
+	}
+	return false
+}
+
+// lastTaskError returns the most recent failed or rejected task that reported an error
+func lastTaskError(tasks []swarm.Task) (swarm.Task, bool) {
+	var last swarm.Task
+	var found bool
+	for _, task := range tasks {
+		if task.Status.State != swarm.TaskStateFailed && task.Status.State != swarm.TaskStateRejected {
+			continue
+		}
+		if task.Status.Err == "" {
+			continue
+		}
+		if !found || task.Status.Timestamp.After(last.Status.Timestamp) {
+			last, found = task, true
+		}
+	}
+	return last, found
+}
+
+// taskExitCode returns the exit code of a task whose container exited by itself, not when the swarm stopped it
+func taskExitCode(task swarm.Task) (int, bool) {
+	if task.Status.State != swarm.TaskStateFailed && task.Status.State != swarm.TaskStateComplete {
+		return 0, false
+	}
+	if task.Status.ContainerStatus == nil {
+		return 0, false
+	}
+	return task.Status.ContainerStatus.ExitCode, true
+}
+
+// observe records the tasks of a service that ended by themselves and returns how many did within the window,
+// with the exit codes counted so far. The tasks already ended when a service is first seen ended before the exporter
+// started, their exit codes are not counted
+func (t *restartTracker) observe(service swarm.Service, tasks []swarm.Task, at time.Time, window time.Duration) restartStats {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	r, ok := t.services[service.ID]
+	if !ok {
+		r = &serviceRestarts{ended: make(map[string]time.Time), exits: make(map[int]uint64)}
+		t.services[service.ID] = r
+	}
+	r.seen = at
+
+	exited := make(map[string]bool)
+	for _, task := range tasks {
+		if taskRestarted(service, task) {
+			r.ended[task.ID] = task.Status.Timestamp
+		}
+		if code, ended := taskExitCode(task); ended {
+			exited[task.ID] = true
+			if ok && !r.exited[task.ID] {
+				r.exits[code]++
+			}
+		}
+	}
+	r.exited = exited
+
+	stats := restartStats{exits: make(map[int]uint64, len(r.exits))}
+	for id, ended := range r.ended {
+		if at.Sub(ended) > window {
+			delete(r.ended, id)
+			continue
+		}
+		stats.restarts++
+	}
+	for code, count := range r.exits {
+		stats.exits[code] = count
+	}
+	return stats
+}
+
+// prune forgets the services not observed for a while
+func (t *restartTracker) prune(now time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for service, r := range t.services {
+		if now.Sub(r.seen) > outageTrackerRetention {
+			delete(t.services, service)
+		}
+	}
+}
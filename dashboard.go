@@ -0,0 +1,229 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+)
+
+// grafanaDashboard is the subset of the Grafana dashboard model the exporter generates
+type grafanaDashboard struct {
+	Title         string            `json:"title"`
+	UID           string            `json:"uid"`
+	SchemaVersion int               `json:"schemaVersion"`
+	Time          map[string]string `json:"time"`
+	Refresh       string            `json:"refresh"`
+	Templating    grafanaTemplating `json:"templating"`
+	Panels        []grafanaPanel    `json:"panels"`
+}
+
+// grafanaTemplating holds the dashboard variables
+type grafanaTemplating struct {
+	List []grafanaVariable `json:"list"`
+}
+
+// grafanaVariable is a dashboard variable
+type grafanaVariable struct {
+	Name       string             `json:"name"`
+	Label      string             `json:"label,omitempty"`
+	Type       string             `json:"type"`
+	Query      string             `json:"query"`
+	Datasource *grafanaDatasource `json:"datasource,omitempty"`
+	Refresh    int                `json:"refresh,omitempty"`
+	IncludeAll bool               `json:"includeAll,omitempty"`
+	Multi      bool               `json:"multi,omitempty"`
+	AllValue   string             `json:"allValue,omitempty"`
+}
+
+// grafanaDatasource references the Prometheus datasource variable
+type grafanaDatasource struct {
+	Type string `json:"type"`
+	UID  string `json:"uid"`
+}
+
+// grafanaPanel is a dashboard panel
+type grafanaPanel struct {
+	ID         int                `json:"id"`
+	Type       string             `json:"type"`
+	Title      string             `json:"title"`
+	GridPos    grafanaGridPos     `json:"gridPos"`
+	Datasource *grafanaDatasource `json:"datasource,omitempty"`
+	Targets    []grafanaTarget    `json:"targets,omitempty"`
+}
+
+// grafanaGridPos places a panel on the dashboard grid
+type grafanaGridPos struct {
+	H int `json:"h"`
+	W int `json:"w"`
+	X int `json:"x"`
+	Y int `json:"y"`
+}
+
+// grafanaTarget is a query of a panel
+type grafanaTarget struct {
+	Expr         string `json:"expr"`
+	LegendFormat string `json:"legendFormat,omitempty"`
+	RefID        string `json:"refId"`
+}
+
+// dashboardBuilder lays out the panels of a dashboard row by row
+type dashboardBuilder struct {
+	dashboard grafanaDashboard
+	x, y      int
+	rowHeight int
+}
+
+// row starts a new row of panels with a title
+func (b *dashboardBuilder) row(title string) {
+	if b.x > 0 {
+		b.y += b.rowHeight
+		b.x = 0
+	}
+	b.panel("row", title, 24, 1)
+}
+
+// panel adds a panel of the given size after the previous one, wrapping at the grid width
+func (b *dashboardBuilder) panel(kind, title string, w, h int, targets ...grafanaTarget) {
+	if b.x+w > 24 {
+		b.y += b.rowHeight
+		b.x = 0
+	}
+	if b.x == 0 {
+		b.rowHeight = 0
+	}
+
+	panel := grafanaPanel{
+		ID:      len(b.dashboard.Panels) + 1,
+		Type:    kind,
+		Title:   title,
+		GridPos: grafanaGridPos{H: h, W: w, X: b.x, Y: b.y},
+	}
+	if kind != "row" {
+		panel.Datasource = &grafanaDatasource{Type: "prometheus", UID: "${datasource}"}
+		for i := range targets {
+			targets[i].RefID = string(rune('A' + i))
+		}
+		panel.Targets = targets
+	}
+	b.dashboard.Panels = append(b.dashboard.Panels, panel)
+
+	b.x += w
+	if h > b.rowHeight {
+		b.rowHeight = h
+	}
+}
+
+// dashboardSelector returns a selector of the family matching the dashboard variables and the extra matchers
+func (c *DockerSwarmCollector) dashboardSelector(d *metricDesc, federated bool, extra ...string) string {
+	matchers := extra
+	if federated {
+		matchers = append(matchers, `cluster=~"$cluster"`)
+	}
+	if d.swarm && c.options.ClusterID != "" {
+		matchers = append(matchers, `cluster_id=~"$cluster_id"`)
+	}
+	if d.swarm && c.options.ClusterName != "" {
+		matchers = append(matchers, `cluster_name=~"$cluster_name"`)
+	}
+	if len(matchers) == 0 {
+		return d.name
+	}
+	return d.name + "{" + strings.Join(matchers, ",") + "}"
+}
+
+// dashboard generates a Grafana dashboard for the metric names and labels of the collector
+func (c *DockerSwarmCollector) dashboard(title string, federated bool) grafanaDashboard {
+	b := &dashboardBuilder{dashboard: grafanaDashboard{
+		Title:         title,
+		UID:           "docker-swarm-exporter",
+		SchemaVersion: 39,
+		Time:          map[string]string{"from": "now-6h", "to": "now"},
+		Refresh:       "30s",
+	}}
+
+	datasource := &grafanaDatasource{Type: "prometheus", UID: "${datasource}"}
+	variables := []grafanaVariable{{Name: "datasource", Label: "Data source", Type: "datasource", Query: "prometheus"}}
+	addVariable := func(label string, d *metricDesc) {
+		variables = append(variables, grafanaVariable{
+			Name:       label,
+			Type:       "query",
+			Query:      fmt.Sprintf("label_values(%s, %s)", d.name, label),
+			Datasource: datasource,
+			Refresh:    2,
+			IncludeAll: true,
+			Multi:      true,
+			AllValue:   ".*",
+		})
+	}
+	if federated {
+		addVariable("cluster", c.up)
+	}
+	if c.options.ClusterID != "" {
+		addVariable("cluster_id", c.servicesCount)
+	}
+	if c.options.ClusterName != "" {
+		addVariable("cluster_name", c.servicesCount)
+	}
+	b.dashboard.Templating.List = variables
+
+	q := func(d *metricDesc, extra ...string) string { return c.dashboardSelector(d, federated, extra...) }
+
+	b.row("Swarm")
+	b.panel("stat", "Nodes", 4, 4, grafanaTarget{Expr: "sum(" + q(c.nodesCount) + ")"})
+	b.panel("stat", "Ready nodes", 4, 4, grafanaTarget{Expr: "sum(" + q(c.nodesActive) + ")"})
+	b.panel("stat", "Reachable managers", 4, 4, grafanaTarget{Expr: "sum(" + q(c.managersReachable) + ")"})
+	b.panel("stat", "Services", 4, 4, grafanaTarget{Expr: "sum(" + q(c.servicesCount) + ")"})
+	b.panel("stat", "Stacks", 4, 4, grafanaTarget{Expr: "sum(" + q(c.stacksCount) + ")"})
+	b.panel("stat", "Running containers", 4, 4, grafanaTarget{Expr: "sum(" + q(c.totalContainersAllNodes) + ")"})
+
+	b.row("Services")
+	b.panel("timeseries", "Missing tasks", 12, 8, grafanaTarget{
+		Expr:         fmt.Sprintf("sum by (service_name) (%s - %s) > 0", q(c.tasksDesired), q(c.tasksRunning)),
+		LegendFormat: "{{service_name}}",
+	})
+	b.panel("timeseries", "Running tasks", 12, 8, grafanaTarget{
+		Expr:         fmt.Sprintf("sum by (service_name) (%s)", q(c.tasksRunning)),
+		LegendFormat: "{{service_name}}",
+	})
+	b.panel("table", "Updates in progress", 24, 6, grafanaTarget{
+		Expr:         q(c.serviceUpdateState, `state!~"none|completed|rollback_completed"`) + " == 1",
+		LegendFormat: "{{service_name}} {{state}}",
+	})
+
+	b.row("Nodes")
+	b.panel("timeseries", "Running containers per node", 12, 8, grafanaTarget{
+		Expr:         fmt.Sprintf("sum by (node_hostname) (%s)", q(c.containersRunningAllNodes)),
+		LegendFormat: "{{node_hostname}}",
+	})
+	b.panel("timeseries", "Published ports per node", 12, 8, grafanaTarget{
+		Expr:         fmt.Sprintf("sum by (node_hostname) (%s)", q(c.nodePublishedPorts)),
+		LegendFormat: "{{node_hostname}}",
+	})
+
+	b.row("Exporter")
+	b.panel("timeseries", "Docker API up", 12, 6, grafanaTarget{Expr: q(c.up), LegendFormat: "{{instance}}"})
+	b.panel("timeseries", "Serving stale data", 12, 6, grafanaTarget{Expr: q(c.dataStale), LegendFormat: "{{instance}}"})
+
+	return b.dashboard
+}
+
+// dashboardHandler serves a Grafana dashboard for the metrics of the collector
+// federated adds a variable for the cluster label of the configured clusters
+func (c *DockerSwarmCollector) dashboardHandler(federated bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		title := r.URL.Query().Get("title")
+		if title == "" {
+			title = "Docker Swarm"
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		encoder.SetEscapeHTML(false)
+		if err := encoder.Encode(c.dashboard(title, federated)); err != nil {
+			log.Printf("Error writing dashboard: %v", err)
+		}
+	}
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"time"
+)
+
+// scrapeTrace is the JSON document served by the scrape debug endpoint
+type scrapeTrace struct {
+	Started         time.Time      `json:"started"`
+	DurationSeconds float64        `json:"duration_seconds"`
+	Failed          bool           `json:"failed"`
+	Skipped         []string       `json:"skipped,omitempty"`
+	Shed            []string       `json:"shed,omitempty"`
+	Warnings        []parseWarning `json:"warnings,omitempty"`
+	Metrics         int            `json:"metrics"`
+	Calls           []apiCall      `json:"calls"`
+	Collectors      []collectorRun `json:"collectors"`
+}
+
+// trace returns the trace of a finished scrape
+func (s *scrape) trace(metrics int) scrapeTrace {
+	return scrapeTrace{
+		Started:         s.started,
+		DurationSeconds: time.Since(s.started).Seconds(),
+		Failed:          s.failed(),
+		Skipped:         s.skipped,
+		Shed:            s.shed,
+		Warnings:        s.warnings,
+		Metrics:         metrics,
+		Calls:           s.calls,
+		Collectors:      s.collectors,
+	}
+}
+
+// traceCollector returns a copy of the collector running on copies of its trackers, so that a traced collection
+// leaves the state carried across scrapes, and the metrics derived from it, untouched
+func (c *DockerSwarmCollector) traceCollector() *DockerSwarmCollector {
+	traced := *c
+	traced.availability = c.availability.clone()
+	traced.outages = c.outages.clone()
+	traced.deployments = c.deployments.clone()
+	traced.startups = c.startups.clone()
+	traced.restarts = c.restarts.clone()
+	traced.probes = c.probes.clone()
+	traced.logs = c.logs.clone()
+	traced.leaders = c.leaders.clone()
+	traced.nodes = c.nodes.clone()
+	// The sub-collectors are bound to the collector they were listed by
+	traced.collectors = traced.subCollectors()
+	return &traced
+}
+
+// serveScrapeTrace performs a collection and returns its trace as JSON
+// The collected metrics are discarded and neither replace the cached ones nor advance the trackers
+func (c *DockerSwarmCollector) serveScrapeTrace(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), c.timeout)
+	defer cancel()
+
+	s := newScrape(ctx, c.docker)
+	c.traceCollector().collect(s)
+	trace := s.trace(len(s.finish()))
+
+	w.Header().Set("Content-Type", "application/json")
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(trace); err != nil {
+		log.Printf("Error writing scrape trace: %v", err)
+	}
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"maps"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/docker/docker/api/types/swarm"
+)
+
+// rolloutBuckets are the upper bounds of docker_service_rollout_duration_seconds
+var rolloutBuckets = []float64{10, 30, 60, 120, 300, 600, 1800, 3600}
+
+// serviceDeployments holds the deployment statistics of a service
+type serviceDeployments struct {
+	// started identifies the last update seen, completed whether its duration was observed
+	started   time.Time
+	completed bool
+
+	total   uint64
+	count   uint64
+	sum     float64
+	buckets map[float64]uint64
+	seen    time.Time
+}
+
+// deploymentTracker counts the updates of every service across scrapes
+type deploymentTracker struct {
+	mu       sync.Mutex
+	services map[string]*serviceDeployments
+}
+
+// newDeploymentTracker creates an empty tracker
+func newDeploymentTracker() *deploymentTracker {
+	return &deploymentTracker{services: make(map[string]*serviceDeployments)}
+}
+
+// clone returns a copy of the tracker sharing no state with it
+func (t *deploymentTracker) clone() *deploymentTracker {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	c := newDeploymentTracker()
+	for service, d := range t.services {
+		copied := *d
+		copied.buckets = maps.Clone(d.buckets)
+		c.services[service] = &copied
+	}
+	return c
+}
+
+// observe records the update status of a service and returns a copy of its statistics
+// The update already present when a service is first seen only counts once it completes
+func (t *deploymentTracker) observe(service string, at time.Time, status *swarm.UpdateStatus) serviceDeployments {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	d, ok := t.services[service]
+	if !ok {
+		d = &serviceDeployments{buckets: make(map[float64]uint64, len(rolloutBuckets))}
+		t.services[service] = d
+	}
+	d.seen = at
+
+	if status == nil || status.StartedAt == nil {
+		return d.copy()
+	}
+
+	if !status.StartedAt.Equal(d.started) {
+		if ok {
+			d.total++
+		}
+		d.started = *status.StartedAt
+		// Updates that completed before the service was first seen were never observed
+		d.completed = !ok && status.State == swarm.UpdateStateCompleted
+	}
+
+	if !d.completed && status.State == swarm.UpdateStateCompleted && status.CompletedAt != nil {
+		d.completed = true
+		duration := status.CompletedAt.Sub(*status.StartedAt).Seconds()
+		d.count++
+		d.sum += duration
+		for _, bound := range rolloutBuckets {
+			if duration <= bound {
+				d.buckets[bound]++
+			}
+		}
+	}
+	return d.copy()
+}
+
+// copy returns the statistics with their own buckets, safe to use without the lock
+func (d *serviceDeployments) copy() serviceDeployments {
+	c := *d
+	c.buckets = make(map[float64]uint64, len(d.buckets))
+	for bound, count := range d.buckets {
+		c.buckets[bound] = count
+	}
+	return c
+}
+
+// updateFailed reports whether the last update of a service failed: the swarm paused it, or rolled it back
+// either on failure or because it was requested
+func updateFailed(status *swarm.UpdateStatus) bool {
+	if status == nil {
+		return false
+	}
+	switch status.State {
+	case swarm.UpdateStatePaused, swarm.UpdateStateRollbackStarted, swarm.UpdateStateRollbackPaused, swarm.UpdateStateRollbackCompleted:
+		return true
+	}
+	return false
+}
+
+// updateProgress returns the share of the tasks desired running that already run the current spec of a service,
+// only while an update or rollback is in progress. A rollback restores the previous spec as the current one
+func updateProgress(service swarm.Service, tasks []swarm.Task) (float64, bool) {
+	if service.UpdateStatus == nil {
+		return 0, false
+	}
+	if service.UpdateStatus.State != swarm.UpdateStateUpdating && service.UpdateStatus.State != swarm.UpdateStateRollbackStarted {
+		return 0, false
+	}
+
+	var total, updated int
+	for _, task := range tasks {
+		if task.DesiredState != swarm.TaskStateRunning {
+			continue
+		}
+		total++
+		// Tasks get a copy of the task template of the service at the time they are created
+		if task.Status.State == swarm.TaskStateRunning && reflect.DeepEqual(task.Spec, service.Spec.TaskTemplate) {
+			updated++
+		}
+	}
+	if total == 0 {
+		return 0, true
+	}
+	return float64(updated) / float64(total), true
+}
+
+// prune forgets the services not observed for a while
+func (t *deploymentTracker) prune(now time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for service, d := range t.services {
+		if now.Sub(d.seen) > outageTrackerRetention {
+			delete(t.services, service)
+		}
+	}
+}
@@ -0,0 +1,289 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/model"
+)
+
+// derivedConfig is a gauge of the derived_metrics section of the configuration file
+type derivedConfig struct {
+	Name string `yaml:"name"`
+	Help string `yaml:"help"`
+	Expr string `yaml:"expr"`
+}
+
+// derivedMetric is a derived gauge with its parsed expression
+type derivedMetric struct {
+	name string
+	help string
+	expr derivedExpr
+}
+
+// parseDerivedMetrics parses the derived gauges of the configuration file
+func parseDerivedMetrics(configs []derivedConfig) ([]derivedMetric, error) {
+	var metrics []derivedMetric
+	names := make(map[string]bool)
+	for _, config := range configs {
+		if !model.IsValidLegacyMetricName(config.Name) {
+			return nil, fmt.Errorf("invalid derived metric name %q", config.Name)
+		}
+		if names[config.Name] {
+			return nil, fmt.Errorf("duplicate derived metric %s", config.Name)
+		}
+		names[config.Name] = true
+
+		expr, err := parseDerivedExpr(config.Expr)
+		if err != nil {
+			return nil, fmt.Errorf("derived metric %s: %w", config.Name, err)
+		}
+		help := config.Help
+		if help == "" {
+			help = "Derived from " + config.Expr
+		}
+		metrics = append(metrics, derivedMetric{name: config.Name, help: help, expr: expr})
+	}
+	return metrics, nil
+}
+
+// derivedSample is a sample of an operand or result of a derived expression
+type derivedSample struct {
+	labels []*dto.LabelPair
+	value  float64
+}
+
+// derivedValue is either a number or a vector of samples keyed by their labels
+type derivedValue struct {
+	scalar  bool
+	value   float64
+	samples map[string]derivedSample
+}
+
+// derivedExpr is a node of a derived expression
+type derivedExpr interface {
+	eval(families map[string]*dto.MetricFamily) derivedValue
+}
+
+// derivedNumber is a number literal
+type derivedNumber float64
+
+// eval implements the derivedExpr interface
+func (n derivedNumber) eval(map[string]*dto.MetricFamily) derivedValue {
+	return derivedValue{scalar: true, value: float64(n)}
+}
+
+// derivedRef refers to the samples of a gathered family, missing families giving no samples
+type derivedRef string
+
+// eval implements the derivedExpr interface
+func (r derivedRef) eval(families map[string]*dto.MetricFamily) derivedValue {
+	v := derivedValue{samples: make(map[string]derivedSample)}
+	family, ok := families[string(r)]
+	if !ok {
+		return v
+	}
+	for _, metric := range family.GetMetric() {
+		value, ok := historyValue(family.GetType(), metric)
+		if !ok {
+			continue
+		}
+		key, _ := historyLabels(metric)
+		v.samples[key] = derivedSample{labels: metric.GetLabel(), value: value}
+	}
+	return v
+}
+
+// derivedBinary applies an arithmetic operator, matching the samples of two vectors with the same labels
+type derivedBinary struct {
+	op          byte
+	left, right derivedExpr
+}
+
+// eval implements the derivedExpr interface
+func (b derivedBinary) eval(families map[string]*dto.MetricFamily) derivedValue {
+	left, right := b.left.eval(families), b.right.eval(families)
+	if left.scalar && right.scalar {
+		return derivedValue{scalar: true, value: b.apply(left.value, right.value)}
+	}
+
+	v := derivedValue{samples: make(map[string]derivedSample)}
+	switch {
+	case left.scalar:
+		for key, sample := range right.samples {
+			v.samples[key] = derivedSample{labels: sample.labels, value: b.apply(left.value, sample.value)}
+		}
+	case right.scalar:
+		for key, sample := range left.samples {
+			v.samples[key] = derivedSample{labels: sample.labels, value: b.apply(sample.value, right.value)}
+		}
+	default:
+		for key, sample := range left.samples {
+			if other, ok := right.samples[key]; ok {
+				v.samples[key] = derivedSample{labels: sample.labels, value: b.apply(sample.value, other.value)}
+			}
+		}
+	}
+	return v
+}
+
+// apply computes the operator on two numbers
+func (b derivedBinary) apply(x, y float64) float64 {
+	switch b.op {
+	case '+':
+		return x + y
+	case '-':
+		return x - y
+	case '*':
+		return x * y
+	}
+	return x / y
+}
+
+// derivedParser is a recursive descent parser of derived expressions:
+// metric names, numbers, + - * / and parentheses
+type derivedParser struct {
+	input string
+	pos   int
+}
+
+// parseDerivedExpr parses a derived expression
+func parseDerivedExpr(input string) (derivedExpr, error) {
+	p := &derivedParser{input: input}
+	expr, err := p.sum()
+	if err != nil {
+		return nil, err
+	}
+	if p.peek() != 0 {
+		return nil, fmt.Errorf("unexpected %q at offset %d", p.input[p.pos], p.pos)
+	}
+	return expr, nil
+}
+
+// peek skips spaces and returns the next character, 0 at the end of the input
+func (p *derivedParser) peek() byte {
+	for p.pos < len(p.input) && (p.input[p.pos] == ' ' || p.input[p.pos] == '\t') {
+		p.pos++
+	}
+	if p.pos == len(p.input) {
+		return 0
+	}
+	return p.input[p.pos]
+}
+
+// sum parses terms separated by + and -
+func (p *derivedParser) sum() (derivedExpr, error) {
+	expr, err := p.product()
+	for err == nil && (p.peek() == '+' || p.peek() == '-') {
+		op := p.input[p.pos]
+		p.pos++
+		var right derivedExpr
+		if right, err = p.product(); err == nil {
+			expr = derivedBinary{op: op, left: expr, right: right}
+		}
+	}
+	return expr, err
+}
+
+// product parses factors separated by * and /
+func (p *derivedParser) product() (derivedExpr, error) {
+	expr, err := p.factor()
+	for err == nil && (p.peek() == '*' || p.peek() == '/') {
+		op := p.input[p.pos]
+		p.pos++
+		var right derivedExpr
+		if right, err = p.factor(); err == nil {
+			expr = derivedBinary{op: op, left: expr, right: right}
+		}
+	}
+	return expr, err
+}
+
+// factor parses a negation, a parenthesized expression, a number or a metric name
+func (p *derivedParser) factor() (derivedExpr, error) {
+	c := p.peek()
+	switch {
+	case c == 0:
+		return nil, fmt.Errorf("unexpected end of expression")
+	case c == '-':
+		p.pos++
+		expr, err := p.factor()
+		return derivedBinary{op: '-', left: derivedNumber(0), right: expr}, err
+	case c == '(':
+		p.pos++
+		expr, err := p.sum()
+		if err != nil {
+			return nil, err
+		}
+		if p.peek() != ')' {
+			return nil, fmt.Errorf("missing ) at offset %d", p.pos)
+		}
+		p.pos++
+		return expr, nil
+	case c >= '0' && c <= '9' || c == '.':
+		start := p.pos
+		for p.pos < len(p.input) && (p.input[p.pos] >= '0' && p.input[p.pos] <= '9' || p.input[p.pos] == '.') {
+			p.pos++
+		}
+		value, err := strconv.ParseFloat(p.input[start:p.pos], 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid number %q", p.input[start:p.pos])
+		}
+		return derivedNumber(value), nil
+	}
+
+	start := p.pos
+	for p.pos < len(p.input) && strings.IndexByte("abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789_:", p.input[p.pos]) >= 0 {
+		p.pos++
+	}
+	if start == p.pos {
+		return nil, fmt.Errorf("unexpected %q at offset %d", c, start)
+	}
+	return derivedRef(p.input[start:p.pos]), nil
+}
+
+// derivedGatherer adds the derived gauges, computed from the metrics of another gatherer, to its metrics
+type derivedGatherer struct {
+	next    prometheus.Gatherer
+	metrics []derivedMetric
+}
+
+// Gather implements the prometheus.Gatherer interface
+// Derived gauges may use the ones defined before them
+func (g derivedGatherer) Gather() ([]*dto.MetricFamily, error) {
+	families, err := g.next.Gather()
+
+	byName := make(map[string]*dto.MetricFamily, len(families))
+	for _, family := range families {
+		byName[family.GetName()] = family
+	}
+	for _, metric := range g.metrics {
+		value := metric.expr.eval(byName)
+		if value.scalar {
+			value.samples = map[string]derivedSample{"": {value: value.value}}
+		}
+		if len(value.samples) == 0 {
+			continue
+		}
+
+		name, help := metric.name, metric.help
+		family := &dto.MetricFamily{Name: &name, Help: &help, Type: dto.MetricType_GAUGE.Enum()}
+		for _, key := range sortedKeys(value.samples) {
+			sample := value.samples[key]
+			family.Metric = append(family.Metric, &dto.Metric{Label: sample.labels, Gauge: &dto.Gauge{Value: &sample.value}})
+		}
+		families = append(families, family)
+		byName[name] = family
+	}
+
+	derived, derivedErr := prometheus.Gatherers{prometheus.GathererFunc(func() ([]*dto.MetricFamily, error) {
+		return families, nil
+	})}.Gather()
+	if err == nil {
+		err = derivedErr
+	}
+	return derived, err
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// metricDesc describes a metric family exposed by the collector, together with
+// the family it replaced when the legacy names are still being exposed
+type metricDesc struct {
+	name       string
+	legacyName string
+	swarm      bool
+	desc       *prometheus.Desc
+	legacy     *prometheus.Desc
+}
+
+// newDesc creates a metric family about the local daemon or the exporter and registers it with the collector
+func (c *DockerSwarmCollector) newDesc(name, help string, labels []string) *metricDesc {
+	return c.addDesc(name, "", help, labels, false)
+}
+
+// newSwarmDesc creates a metric family about the swarm and registers it with the collector
+func (c *DockerSwarmCollector) newSwarmDesc(name, help string, labels []string) *metricDesc {
+	return c.addDesc(name, "", help, labels, true)
+}
+
+// newLegacyDesc creates a renamed metric family about the local daemon that is
+// also exposed under its legacy name when the legacy names are enabled
+func (c *DockerSwarmCollector) newLegacyDesc(name, legacyName, help string, labels []string) *metricDesc {
+	return c.addDesc(name, legacyName, help, labels, false)
+}
+
+// newLegacySwarmDesc creates a renamed metric family about the swarm that is
+// also exposed under its legacy name when the legacy names are enabled
+func (c *DockerSwarmCollector) newLegacySwarmDesc(name, legacyName, help string, labels []string) *metricDesc {
+	return c.addDesc(name, legacyName, help, labels, true)
+}
+
+// addDesc creates a metric family and registers it with the collector
+// Swarm families carry the cluster identity as constant labels
+func (c *DockerSwarmCollector) addDesc(name, legacyName, help string, labels []string, swarm bool) *metricDesc {
+	var constLabels prometheus.Labels
+	if swarm {
+		constLabels = c.clusterLabels()
+	}
+
+	name = c.metricName(name)
+	d := &metricDesc{
+		name:  name,
+		swarm: swarm,
+		desc:  prometheus.NewDesc(name, help, labels, constLabels),
+	}
+	if legacyName != "" && c.options.LegacyNames {
+		d.legacyName = legacyName
+		d.legacy = prometheus.NewDesc(legacyName, help, labels, constLabels)
+	}
+	c.descs = append(c.descs, d)
+	return d
+}
+
+// metricName returns the name a metric family is exposed under, custom when the configuration file renames it
+func (c *DockerSwarmCollector) metricName(name string) string {
+	if custom, ok := c.options.MetricNames[name]; ok {
+		return custom
+	}
+	return name
+}
+
+// clusterLabels returns the constant labels identifying the swarm cluster
+func (c *DockerSwarmCollector) clusterLabels() prometheus.Labels {
+	labels := prometheus.Labels{}
+	if c.options.ClusterID != "" {
+		labels["cluster_id"] = c.options.ClusterID
+	}
+	if c.options.ClusterName != "" {
+		labels["cluster_name"] = c.options.ClusterName
+	}
+	return labels
+}
+
+// familyNames returns the names of the swarm families, or of the other families, including legacy names
+func (c *DockerSwarmCollector) familyNames(swarm bool) map[string]bool {
+	names := make(map[string]bool)
+	for _, d := range c.descs {
+		if d.swarm != swarm {
+			continue
+		}
+		names[d.name] = true
+		if d.legacyName != "" {
+			names[d.legacyName] = true
+		}
+	}
+	return names
+}
+
+// describe sends the descriptors of the family
+func (d *metricDesc) describe(ch chan<- *prometheus.Desc) {
+	ch <- d.desc
+	if d.legacy != nil {
+		ch <- d.legacy
+	}
+}
+
+// metric sends a sample of the family, duplicated under the legacy name when enabled
+func (d *metricDesc) metric(ch chan<- prometheus.Metric, valueType prometheus.ValueType, value float64, labelValues ...string) {
+	ch <- prometheus.MustNewConstMetric(d.desc, valueType, value, labelValues...)
+	if d.legacy != nil {
+		ch <- prometheus.MustNewConstMetric(d.legacy, valueType, value, labelValues...)
+	}
+}
+
+// gauge sends a gauge sample of the family
+func (d *metricDesc) gauge(ch chan<- prometheus.Metric, value float64, labelValues ...string) {
+	d.metric(ch, prometheus.GaugeValue, value, labelValues...)
+}
+
+// counter sends a counter sample of the family
+func (d *metricDesc) counter(ch chan<- prometheus.Metric, value float64, labelValues ...string) {
+	d.metric(ch, prometheus.CounterValue, value, labelValues...)
+}
+
+// histogram sends a histogram sample of the family, duplicated under the legacy name when enabled
+func (d *metricDesc) histogram(ch chan<- prometheus.Metric, count uint64, sum float64, buckets map[float64]uint64, labelValues ...string) {
+	ch <- prometheus.MustNewConstHistogram(d.desc, count, sum, buckets, labelValues...)
+	if d.legacy != nil {
+		ch <- prometheus.MustNewConstHistogram(d.legacy, count, sum, buckets, labelValues...)
+	}
+}
+
+// sanitizeLabelName turns an arbitrary key into a valid Prometheus label name
+func sanitizeLabelName(key string) string {
+	var b strings.Builder
+	for i, r := range key {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r == '_':
+			b.WriteRune(r)
+		case r >= '0' && r <= '9' && i > 0:
+			b.WriteRune(r)
+		default:
+			b.WriteRune('_')
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"runtime"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/api/types/network"
+	"github.com/docker/docker/api/types/swarm"
+	"github.com/docker/docker/api/types/system"
+	"github.com/docker/docker/client"
+	"github.com/docker/go-connections/tlsconfig"
+)
+
+// defaultDockerSocket returns the endpoint of the local Docker daemon, the named pipe of Docker Engine on Windows
+func defaultDockerSocket() string {
+	if runtime.GOOS == "windows" {
+		return "npipe:////./pipe/docker_engine"
+	}
+	return "unix:///var/run/docker.sock"
+}
+
+// dockerAPI is the read-only subset of the Docker client used by the collector
+type dockerAPI interface {
+	Info(ctx context.Context) (system.Info, error)
+	ContainerList(ctx context.Context, options container.ListOptions) ([]container.Summary, error)
+	ContainerInspect(ctx context.Context, containerID string) (container.InspectResponse, error)
+	NetworkList(ctx context.Context, options network.ListOptions) ([]network.Summary, error)
+	ServiceList(ctx context.Context, options types.ServiceListOptions) ([]swarm.Service, error)
+	TaskList(ctx context.Context, options types.TaskListOptions) ([]swarm.Task, error)
+	NodeList(ctx context.Context, options types.NodeListOptions) ([]swarm.Node, error)
+	ServiceLogs(ctx context.Context, serviceID string, options container.LogsOptions) (io.ReadCloser, error)
+	SecretList(ctx context.Context, options types.SecretListOptions) ([]swarm.Secret, error)
+	ConfigList(ctx context.Context, options types.ConfigListOptions) ([]swarm.Config, error)
+}
+
+// tracingDocker records every Docker API call of a scrape
+type tracingDocker struct {
+	api dockerAPI
+	s   *scrape
+}
+
+// Info implements the dockerAPI interface
+func (t tracingDocker) Info(ctx context.Context) (system.Info, error) {
+	start := time.Now()
+	info, err := t.api.Info(ctx)
+	t.s.recordCall("Info", filters.Args{}, start, 1, err)
+	return info, err
+}
+
+// ContainerList implements the dockerAPI interface
+func (t tracingDocker) ContainerList(ctx context.Context, options container.ListOptions) ([]container.Summary, error) {
+	start := time.Now()
+	containers, err := t.api.ContainerList(ctx, options)
+	t.s.recordCall("ContainerList", options.Filters, start, len(containers), err)
+	return containers, err
+}
+
+// ContainerInspect implements the dockerAPI interface
+func (t tracingDocker) ContainerInspect(ctx context.Context, containerID string) (container.InspectResponse, error) {
+	start := time.Now()
+	details, err := t.api.ContainerInspect(ctx, containerID)
+	t.s.recordCall("ContainerInspect", filters.Args{}, start, 1, err)
+	return details, err
+}
+
+// NetworkList implements the dockerAPI interface
+func (t tracingDocker) NetworkList(ctx context.Context, options network.ListOptions) ([]network.Summary, error) {
+	start := time.Now()
+	networks, err := t.api.NetworkList(ctx, options)
+	t.s.recordCall("NetworkList", options.Filters, start, len(networks), err)
+	return networks, err
+}
+
+// ServiceList implements the dockerAPI interface
+func (t tracingDocker) ServiceList(ctx context.Context, options types.ServiceListOptions) ([]swarm.Service, error) {
+	start := time.Now()
+	services, err := t.api.ServiceList(ctx, options)
+	t.s.recordCall("ServiceList", options.Filters, start, len(services), err)
+	return services, err
+}
+
+// TaskList implements the dockerAPI interface
+func (t tracingDocker) TaskList(ctx context.Context, options types.TaskListOptions) ([]swarm.Task, error) {
+	start := time.Now()
+	tasks, err := t.api.TaskList(ctx, options)
+	t.s.recordCall("TaskList", options.Filters, start, len(tasks), err)
+	return tasks, err
+}
+
+// NodeList implements the dockerAPI interface
+func (t tracingDocker) NodeList(ctx context.Context, options types.NodeListOptions) ([]swarm.Node, error) {
+	start := time.Now()
+	nodes, err := t.api.NodeList(ctx, options)
+	t.s.recordCall("NodeList", options.Filters, start, len(nodes), err)
+	return nodes, err
+}
+
+// ServiceLogs implements the dockerAPI interface
+func (t tracingDocker) ServiceLogs(ctx context.Context, serviceID string, options container.LogsOptions) (io.ReadCloser, error) {
+	start := time.Now()
+	logs, err := t.api.ServiceLogs(ctx, serviceID, options)
+	t.s.recordCall("ServiceLogs", filters.Args{}, start, 1, err)
+	return logs, err
+}
+
+// SecretList implements the dockerAPI interface
+func (t tracingDocker) SecretList(ctx context.Context, options types.SecretListOptions) ([]swarm.Secret, error) {
+	start := time.Now()
+	secrets, err := t.api.SecretList(ctx, options)
+	t.s.recordCall("SecretList", options.Filters, start, len(secrets), err)
+	return secrets, err
+}
+
+// ConfigList implements the dockerAPI interface
+func (t tracingDocker) ConfigList(ctx context.Context, options types.ConfigListOptions) ([]swarm.Config, error) {
+	start := time.Now()
+	configs, err := t.api.ConfigList(ctx, options)
+	t.s.recordCall("ConfigList", options.Filters, start, len(configs), err)
+	return configs, err
+}
+
+// readOnlyTransport refuses every request but GET and HEAD, so the exporter cannot change the state of the daemon
+type readOnlyTransport struct {
+	next http.RoundTripper
+}
+
+// RoundTrip implements the http.RoundTripper interface
+func (t readOnlyTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Method != http.MethodGet && req.Method != http.MethodHead {
+		return nil, fmt.Errorf("refusing %s %s, the exporter only reads from the Docker API", req.Method, req.URL.Path)
+	}
+	return t.next.RoundTrip(req)
+}
+
+// newDockerClient creates a Docker client for the host that can only make read-only requests
+// The TLS files of a cluster are used when one is given, restricted by the TLS settings
+func newDockerClient(host string, cluster *clusterConfig, settings tlsSettings) (*client.Client, error) {
+	opts := []client.Opt{client.WithHost(host), client.WithAPIVersionNegotiation()}
+
+	var httpClient *http.Client
+	if cluster != nil {
+		config, err := tlsconfig.Client(tlsconfig.Options{
+			CAFile:             cluster.TLSCAFile,
+			CertFile:           cluster.TLSCertFile,
+			KeyFile:            cluster.TLSKeyFile,
+			ExclusiveRootPools: true,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("loading TLS files: %w", err)
+		}
+		settings.apply(config)
+		httpClient = &http.Client{
+			Transport:     &http.Transport{Proxy: http.ProxyFromEnvironment, TLSClientConfig: config},
+			CheckRedirect: client.CheckRedirect,
+		}
+		// The scheme can no longer be told from the guarded transport
+		opts = append(opts, client.WithScheme("https"))
+	} else {
+		// Let the Docker client set up the transport for the socket
+		configured, err := client.NewClientWithOpts(opts...)
+		if err != nil {
+			return nil, err
+		}
+		httpClient = configured.HTTPClient()
+	}
+
+	httpClient.Transport = readOnlyTransport{next: httpClient.Transport}
+	opts = append(opts, client.WithHTTPClient(httpClient))
+	return client.NewClientWithOpts(opts...)
+}
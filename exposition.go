@@ -0,0 +1,25 @@
+package main
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+
+	// Offer zstd alongside gzip to the scrapers accepting it
+	_ "github.com/prometheus/client_golang/prometheus/promhttp/zstd"
+)
+
+// helpStrippingGatherer leaves the HELP text out of the metrics of another gatherer, a large part of the payload of
+// expositions with many families and few series each
+type helpStrippingGatherer struct {
+	next prometheus.Gatherer
+}
+
+// Gather implements the prometheus.Gatherer interface
+func (g helpStrippingGatherer) Gather() ([]*dto.MetricFamily, error) {
+	families, err := g.next.Gather()
+	stripped := make([]*dto.MetricFamily, len(families))
+	for i, family := range families {
+		stripped[i] = &dto.MetricFamily{Name: family.Name, Type: family.Type, Unit: family.Unit, Metric: family.Metric}
+	}
+	return stripped, err
+}
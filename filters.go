@@ -0,0 +1,222 @@
+package main
+
+import (
+	"fmt"
+	"hash/fnv"
+	"regexp"
+	"strings"
+
+	"github.com/docker/docker/api/types/swarm"
+)
+
+// stackNamespaceLabel is the label docker stack deploy sets on the services of a stack
+const stackNamespaceLabel = "com.docker.stack.namespace"
+
+// stackFilter selects services by their stack namespace
+type stackFilter struct {
+	include *regexp.Regexp
+	exclude *regexp.Regexp
+}
+
+// newStackFilter compiles the include and exclude expressions, either of which may be empty
+func newStackFilter(include, exclude string) (stackFilter, error) {
+	var f stackFilter
+	var err error
+	if f.include, err = compileAnchored(include); err != nil {
+		return f, fmt.Errorf("invalid stack include expression: %w", err)
+	}
+	if f.exclude, err = compileAnchored(exclude); err != nil {
+		return f, fmt.Errorf("invalid stack exclude expression: %w", err)
+	}
+	return f, nil
+}
+
+// matches reports whether the stack of a service is selected by the filter
+func (f stackFilter) matches(service swarm.Service) bool {
+	stack := service.Spec.Labels[stackNamespaceLabel]
+	if f.include != nil && !f.include.MatchString(stack) {
+		return false
+	}
+	if f.exclude != nil && f.exclude.MatchString(stack) {
+		return false
+	}
+	return true
+}
+
+// filter returns the services selected by the filter
+func (f stackFilter) filter(services []swarm.Service) []swarm.Service {
+	if f.include == nil && f.exclude == nil {
+		return services
+	}
+
+	selected := make([]swarm.Service, 0, len(services))
+	for _, service := range services {
+		if f.matches(service) {
+			selected = append(selected, service)
+		}
+	}
+	return selected
+}
+
+// nodeLabelPrefix marks a node selector that matches a label instead of the hostname
+const nodeLabelPrefix = "label:"
+
+// nodeSelector matches a node by hostname expression or by label
+type nodeSelector struct {
+	hostname   *regexp.Regexp
+	labelKey   string
+	labelValue string
+}
+
+// parseNodeSelector parses either "label:key=value" or a hostname expression
+func parseNodeSelector(value string) (nodeSelector, error) {
+	if strings.HasPrefix(value, nodeLabelPrefix) {
+		key, labelValue, _ := strings.Cut(strings.TrimPrefix(value, nodeLabelPrefix), "=")
+		if key == "" {
+			return nodeSelector{}, fmt.Errorf("invalid node label selector %q", value)
+		}
+		return nodeSelector{labelKey: key, labelValue: labelValue}, nil
+	}
+
+	hostname, err := compileAnchored(value)
+	if err != nil {
+		return nodeSelector{}, fmt.Errorf("invalid node hostname expression: %w", err)
+	}
+	return nodeSelector{hostname: hostname}, nil
+}
+
+// matches reports whether a node is matched by the selector
+func (s nodeSelector) matches(node swarm.Node) bool {
+	if s.hostname != nil {
+		return s.hostname.MatchString(node.Description.Hostname)
+	}
+
+	// Node spec labels take precedence over engine labels
+	value, ok := node.Spec.Labels[s.labelKey]
+	if !ok {
+		value, ok = node.Description.Engine.Labels[s.labelKey]
+	}
+	return ok && value == s.labelValue
+}
+
+// nodeFilter selects the nodes that produce per-node metrics
+type nodeFilter struct {
+	include []nodeSelector
+	exclude []nodeSelector
+}
+
+// newNodeFilter parses the include and exclude selectors
+func newNodeFilter(include, exclude []string) (nodeFilter, error) {
+	var f nodeFilter
+	for _, value := range include {
+		selector, err := parseNodeSelector(value)
+		if err != nil {
+			return f, err
+		}
+		f.include = append(f.include, selector)
+	}
+	for _, value := range exclude {
+		selector, err := parseNodeSelector(value)
+		if err != nil {
+			return f, err
+		}
+		f.exclude = append(f.exclude, selector)
+	}
+	return f, nil
+}
+
+// matches reports whether a node is selected by the filter
+func (f nodeFilter) matches(node swarm.Node) bool {
+	if len(f.include) > 0 {
+		included := false
+		for _, selector := range f.include {
+			if selector.matches(node) {
+				included = true
+				break
+			}
+		}
+		if !included {
+			return false
+		}
+	}
+	for _, selector := range f.exclude {
+		if selector.matches(node) {
+			return false
+		}
+	}
+	return true
+}
+
+// containerLabelFilter ignores containers carrying any of the configured labels
+type containerLabelFilter []labelMatcher
+
+// labelMatcher matches a label key, and its value when one is given
+type labelMatcher struct {
+	key      string
+	value    string
+	anyValue bool
+}
+
+// newContainerLabelFilter parses "key=value" or bare "key" matchers
+func newContainerLabelFilter(values []string) (containerLabelFilter, error) {
+	var f containerLabelFilter
+	for _, value := range values {
+		key, labelValue, hasValue := strings.Cut(value, "=")
+		if key == "" {
+			return nil, fmt.Errorf("invalid container label matcher %q", value)
+		}
+		f = append(f, labelMatcher{key: key, value: labelValue, anyValue: !hasValue})
+	}
+	return f, nil
+}
+
+// ignored reports whether a container with the given labels is ignored
+func (f containerLabelFilter) ignored(labels map[string]string) bool {
+	for _, matcher := range f {
+		value, ok := labels[matcher.key]
+		if ok && (matcher.anyValue || value == matcher.value) {
+			return true
+		}
+	}
+	return false
+}
+
+// shardFilter selects the services handled by one of several exporter instances
+type shardFilter struct {
+	count int
+	index int
+}
+
+// newShardFilter checks that the index is within the shard count
+func newShardFilter(count, index int) (shardFilter, error) {
+	if count < 1 {
+		return shardFilter{}, fmt.Errorf("invalid shard count %d", count)
+	}
+	if index < 0 || index >= count {
+		return shardFilter{}, fmt.Errorf("invalid shard index %d for %d shards", index, count)
+	}
+	return shardFilter{count: count, index: index}, nil
+}
+
+// matches reports whether a service belongs to the shard, by hash of its ID
+func (f shardFilter) matches(service swarm.Service) bool {
+	if f.count <= 1 {
+		return true
+	}
+	h := fnv.New32a()
+	h.Write([]byte(service.ID))
+	return int(h.Sum32()%uint32(f.count)) == f.index
+}
+
+// primary reports whether the shard exposes the metrics that are not split across shards
+func (f shardFilter) primary() bool {
+	return f.index == 0
+}
+
+// compileAnchored compiles an expression that must match the whole value
+func compileAnchored(expr string) (*regexp.Regexp, error) {
+	if expr == "" {
+		return nil, nil
+	}
+	return regexp.Compile("^(?:" + expr + ")$")
+}
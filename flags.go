@@ -0,0 +1,40 @@
+package main
+
+import (
+	"flag"
+	"strings"
+)
+
+// stringSliceFlag is a flag that may be given several times
+type stringSliceFlag []string
+
+// String implements the flag.Value interface
+func (s *stringSliceFlag) String() string {
+	return strings.Join(*s, ",")
+}
+
+// Set implements the flag.Value interface
+func (s *stringSliceFlag) Set(value string) error {
+	*s = append(*s, value)
+	return nil
+}
+
+// stringSlice defines a repeatable string flag
+func stringSlice(name, usage string) *stringSliceFlag {
+	var s stringSliceFlag
+	flag.Var(&s, name, usage)
+	return &s
+}
+
+// splitList splits comma-separated flag values and drops empty entries
+func splitList(values []string) []string {
+	var list []string
+	for _, value := range values {
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				list = append(list, item)
+			}
+		}
+	}
+	return list
+}
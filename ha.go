@@ -0,0 +1,49 @@
+package main
+
+import (
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/api/types/swarm"
+	"github.com/docker/docker/api/types/system"
+)
+
+// haActive reports whether this replica should emit the swarm metrics
+// Among the running tasks of the exporter service on reachable managers, the replica on the node with the lowest ID
+// is active; replicas on workers cannot list the swarm objects and never win
+func (c *DockerSwarmCollector) haActive(s *scrape, info system.Info) bool {
+	if c.options.HAService == "" {
+		return true
+	}
+
+	args := filters.NewArgs(
+		filters.Arg("service", c.options.HAService),
+		filters.Arg("desired-state", "running"),
+	)
+	tasks, err := s.docker.TaskList(s.ctx, types.TaskListOptions{Filters: args})
+	if err != nil {
+		// Better to expose the swarm metrics twice than not at all
+		if !unavailable(err) {
+			s.apiError("Error listing exporter tasks: %v", err)
+		}
+		return true
+	}
+	nodes, err := s.nodes()
+	if err != nil {
+		return true
+	}
+
+	managers := make(map[string]bool)
+	for _, node := range nodes {
+		if node.ManagerStatus != nil && node.ManagerStatus.Reachability == swarm.ReachabilityReachable {
+			managers[node.ID] = true
+		}
+	}
+
+	self := info.Swarm.NodeID
+	for _, task := range tasks {
+		if task.Status.State == swarm.TaskStateRunning && managers[task.NodeID] && task.NodeID < self {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"time"
+
+	"github.com/docker/docker/api/types/swarm"
+)
+
+// healthRules decide when a service counts as healthy on docker_service_healthy
+type healthRules struct {
+	// FailureWindow is how far back failed tasks count against a service
+	FailureWindow time.Duration
+
+	// MaxFailures is the number of failed tasks within the window a healthy service may have
+	MaxFailures int
+
+	// UpdatingHealthy keeps a service healthy while missing tasks during an update or rollback
+	UpdatingHealthy bool
+
+	// CrashLoopWindow is how far back restarted tasks count, CrashLoopRestarts how many make a service crash-loop
+	CrashLoopWindow   time.Duration
+	CrashLoopRestarts int
+}
+
+// healthy reports whether a service is healthy: every desired task is running, its last
+// update did not pause on failure, and few enough of its tasks failed recently
+func (r healthRules) healthy(running, desired uint64, updateState string, tasks []swarm.Task, now time.Time) bool {
+	switch swarm.UpdateState(updateState) {
+	case swarm.UpdateStatePaused, swarm.UpdateStateRollbackPaused:
+		return false
+	case swarm.UpdateStateUpdating, swarm.UpdateStateRollbackStarted:
+		if running < desired && !r.UpdatingHealthy {
+			return false
+		}
+	default:
+		if running < desired {
+			return false
+		}
+	}
+
+	var failures int
+	for _, task := range tasks {
+		if task.Status.State != swarm.TaskStateFailed && task.Status.State != swarm.TaskStateRejected {
+			continue
+		}
+		if now.Sub(task.Status.Timestamp) <= r.FailureWindow {
+			failures++
+		}
+	}
+	return failures <= r.MaxFailures
+}
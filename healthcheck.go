@@ -0,0 +1,129 @@
+package main
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/errdefs"
+)
+
+// swarmServiceNameLabel is the label the swarm sets on the containers of its tasks
+const swarmServiceNameLabel = "com.docker.swarm.service.name"
+
+// containerProbes holds the healthcheck probes of a container counted so far
+type containerProbes struct {
+	// last is the end of the latest probe counted
+	last     time.Time
+	failures uint64
+	seen     time.Time
+}
+
+// probeTracker counts the failed healthcheck probes of every container across scrapes,
+// as a container only keeps its last five probes
+type probeTracker struct {
+	mu         sync.Mutex
+	containers map[string]*containerProbes
+}
+
+// newProbeTracker creates an empty tracker
+func newProbeTracker() *probeTracker {
+	return &probeTracker{containers: make(map[string]*containerProbes)}
+}
+
+// clone returns a copy of the tracker sharing no state with it
+func (t *probeTracker) clone() *probeTracker {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	c := newProbeTracker()
+	for id, p := range t.containers {
+		copied := *p
+		c.containers[id] = &copied
+	}
+	return c
+}
+
+// observe records the probes of a container ended since the previous scrape and returns its failed probes
+// The probes already in the log when a container is first seen are not counted
+func (t *probeTracker) observe(id string, at time.Time, probes []*container.HealthcheckResult) uint64 {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	p, ok := t.containers[id]
+	if !ok {
+		p = &containerProbes{}
+		t.containers[id] = p
+	}
+	p.seen = at
+
+	for _, probe := range probes {
+		if probe == nil || !probe.End.After(p.last) {
+			continue
+		}
+		p.last = probe.End
+		if ok && probe.ExitCode != 0 {
+			p.failures++
+		}
+	}
+	return p.failures
+}
+
+// prune forgets the containers not observed for a while, e.g. after they were removed
+func (t *probeTracker) prune(now time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for id, p := range t.containers {
+		if now.Sub(p.seen) > outageTrackerRetention {
+			delete(t.containers, id)
+		}
+	}
+}
+
+// collectContainerHealthcheckMetrics collects the healthcheck probes of the running containers of the local daemon
+// Only containers whose status shows a health state are inspected
+func (c *DockerSwarmCollector) collectContainerHealthcheckMetrics(s *scrape) {
+	containers, err := s.docker.ContainerList(s.ctx, container.ListOptions{})
+	if err != nil {
+		if !unavailable(err) {
+			s.apiError("Error listing running containers: %v", err)
+		}
+		return
+	}
+
+	for _, summary := range containers {
+		if c.options.IgnoredContainers.ignored(summary.Labels) || !strings.Contains(summary.Status, "health") {
+			continue
+		}
+
+		details, err := s.docker.ContainerInspect(s.ctx, summary.ID)
+		if errdefs.IsNotFound(err) {
+			// The container was removed since it was listed
+			continue
+		}
+		if err != nil {
+			if !unavailable(err) {
+				s.apiError("Error inspecting container %s: %v", summary.ID, err)
+			}
+			return
+		}
+		if details.ContainerJSONBase == nil || details.State == nil || details.State.Health == nil {
+			continue
+		}
+
+		name := labelValue(strings.TrimPrefix(details.Name, "/"))
+		service := labelValue(summary.Labels[swarmServiceNameLabel])
+		probes := details.State.Health.Log
+
+		failures := c.probes.observe(summary.ID, s.started, probes)
+		c.containerProbeFailures.counter(s.ch, float64(failures), name, service)
+		if len(probes) > 0 && probes[len(probes)-1] != nil {
+			latest := probes[len(probes)-1]
+			if latest.End.After(latest.Start) {
+				c.containerProbeDuration.gauge(s.ch, latest.End.Sub(latest.Start).Seconds(), name, service)
+			}
+		}
+	}
+	c.probes.prune(s.started)
+}
@@ -0,0 +1,250 @@
+package main
+
+import (
+	"context"
+	"log"
+	"math"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// defaultHistoryMetrics are the families kept by the history when --history.metrics is not given
+var defaultHistoryMetrics = []string{
+	"docker_up",
+	"docker_tasks_running",
+	"docker_tasks_desired",
+	"docker_nodes_active",
+	"docker_service_healthy",
+}
+
+// historyPoint is a sample of a series kept by the history
+type historyPoint struct {
+	Time  time.Time `json:"time"`
+	Value float64   `json:"value"`
+}
+
+// historySeries is a ring buffer of the samples of one series
+type historySeries struct {
+	labels map[string]string
+	points []historyPoint
+	// start is the index of the oldest point once the buffer is full
+	start int
+}
+
+// add appends a point, overwriting the oldest one when the buffer is full
+func (s *historySeries) add(p historyPoint, capacity int) {
+	if len(s.points) < capacity {
+		s.points = append(s.points, p)
+		return
+	}
+	s.points[s.start] = p
+	s.start = (s.start + 1) % len(s.points)
+}
+
+// since returns the points not older than a time, oldest first
+func (s *historySeries) since(from time.Time) []historyPoint {
+	points := make([]historyPoint, 0, len(s.points))
+	for i := range s.points {
+		p := s.points[(s.start+i)%len(s.points)]
+		if !p.Time.Before(from) {
+			points = append(points, p)
+		}
+	}
+	return points
+}
+
+// latest returns the time of the newest point
+func (s *historySeries) latest() time.Time {
+	return s.points[(s.start+len(s.points)-1)%len(s.points)].Time
+}
+
+// history samples a few metric families at a fixed resolution and keeps them in memory for the range API,
+// for swarms without a Prometheus server
+type history struct {
+	gatherer   prometheus.Gatherer
+	metrics    map[string]bool
+	resolution time.Duration
+	retention  time.Duration
+
+	mu     sync.Mutex
+	series map[string]map[string]*historySeries
+}
+
+// newHistory creates a history of the given families, gathered from the metrics exposed by the exporter
+func newHistory(gatherer prometheus.Gatherer, metrics []string, resolution, retention time.Duration) *history {
+	h := &history{
+		gatherer:   gatherer,
+		metrics:    make(map[string]bool),
+		resolution: resolution,
+		retention:  retention,
+		series:     make(map[string]map[string]*historySeries),
+	}
+	for _, metric := range metrics {
+		h.metrics[metric] = true
+	}
+	return h
+}
+
+// run samples the metrics at every resolution step until the context is canceled
+func (h *history) run(ctx context.Context) {
+	ticker := time.NewTicker(h.resolution)
+	defer ticker.Stop()
+
+	for {
+		h.sample(time.Now())
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// sample gathers the metrics once and records the gauges, counters and untyped samples of the kept families
+func (h *history) sample(at time.Time) {
+	families, err := h.gatherer.Gather()
+	if err != nil {
+		log.Printf("Error gathering metrics for the history: %v", err)
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	capacity := int(h.retention / h.resolution)
+	for _, family := range families {
+		if !h.metrics[family.GetName()] {
+			continue
+		}
+		series, ok := h.series[family.GetName()]
+		if !ok {
+			series = make(map[string]*historySeries)
+			h.series[family.GetName()] = series
+		}
+		for _, metric := range family.GetMetric() {
+			value, ok := historyValue(family.GetType(), metric)
+			if !ok || math.IsNaN(value) || math.IsInf(value, 0) {
+				continue
+			}
+			key, labels := historyLabels(metric)
+			s, ok := series[key]
+			if !ok {
+				s = &historySeries{labels: labels}
+				series[key] = s
+			}
+			s.add(historyPoint{Time: at, Value: value}, capacity)
+		}
+	}
+
+	// Series that disappeared are forgotten once their last point left the retention
+	for name, series := range h.series {
+		for key, s := range series {
+			if at.Sub(s.latest()) > h.retention {
+				delete(series, key)
+			}
+		}
+		if len(series) == 0 {
+			delete(h.series, name)
+		}
+	}
+}
+
+// historyValue returns the value of a gauge, counter or untyped sample
+func historyValue(kind dto.MetricType, metric *dto.Metric) (float64, bool) {
+	switch kind {
+	case dto.MetricType_GAUGE:
+		return metric.GetGauge().GetValue(), true
+	case dto.MetricType_COUNTER:
+		return metric.GetCounter().GetValue(), true
+	case dto.MetricType_UNTYPED:
+		return metric.GetUntyped().GetValue(), true
+	}
+	return 0, false
+}
+
+// historyLabels returns the labels of a sample and a key identifying its series
+func historyLabels(metric *dto.Metric) (string, map[string]string) {
+	labels := make(map[string]string, len(metric.GetLabel()))
+	var key strings.Builder
+	for _, pair := range metric.GetLabel() {
+		labels[pair.GetName()] = pair.GetValue()
+		key.WriteString(pair.GetName())
+		key.WriteByte(0)
+		key.WriteString(pair.GetValue())
+		key.WriteByte(0)
+	}
+	return key.String(), labels
+}
+
+// apiRangeSeries is a series of the range API
+type apiRangeSeries struct {
+	Labels map[string]string `json:"labels"`
+	Points []historyPoint    `json:"points"`
+}
+
+// apiRange is the response of the range API
+type apiRange struct {
+	Metric     string           `json:"metric"`
+	Resolution string           `json:"resolution"`
+	Series     []apiRangeSeries `json:"series"`
+}
+
+// rangeAPIHandler returns the kept points of the series of the metric query parameter, within the range query
+// parameter when given; every other query parameter selects the series with that label value
+func (h *history) rangeAPIHandler(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	metric := query.Get("metric")
+	if metric == "" {
+		http.Error(w, "missing metric parameter", http.StatusBadRequest)
+		return
+	}
+	if !h.metrics[metric] {
+		http.Error(w, "metric "+metric+" is not kept in the history", http.StatusNotFound)
+		return
+	}
+	window := h.retention
+	if value := query.Get("range"); value != "" {
+		d, err := time.ParseDuration(value)
+		if err != nil || d <= 0 {
+			http.Error(w, "invalid range parameter", http.StatusBadRequest)
+			return
+		}
+		window = min(d, h.retention)
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	from := time.Now().Add(-window)
+	response := apiRange{Metric: metric, Resolution: h.resolution.String(), Series: []apiRangeSeries{}}
+	series := h.series[metric]
+	for _, key := range sortedKeys(series) {
+		s := series[key]
+		if !historySelected(query, s.labels) {
+			continue
+		}
+		points := s.since(from)
+		if len(points) == 0 {
+			continue
+		}
+		response.Series = append(response.Series, apiRangeSeries{Labels: s.labels, Points: points})
+	}
+	writeJSON(w, response)
+}
+
+// historySelected reports whether the labels of a series match the label query parameters
+func historySelected(query map[string][]string, labels map[string]string) bool {
+	for name, values := range query {
+		if name == "metric" || name == "range" {
+			continue
+		}
+		if len(values) > 0 && !matchesParam(values[0], labels[name]) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"strings"
+
+	"github.com/docker/docker/api/types/swarm"
+)
+
+// labelRules normalizes the label values taken from the names of Docker objects
+type labelRules struct {
+	// TrimStackPrefix removes the "<stack>_" prefix docker stack deploy adds to service names
+	TrimStackPrefix bool
+
+	// StackLabel adds the stack namespace of a service as the stack label and trims the prefix from its name
+	StackLabel bool
+
+	// Tenants adds the tenant of a service as a label when the configuration file assigns tenants
+	Tenants tenantRules
+}
+
+// serviceLabelNames returns the label names identifying a service, followed by the extra ones
+func (c *DockerSwarmCollector) serviceLabelNames(extra ...string) []string {
+	names := []string{"service_id", "service_name"}
+	if c.options.Labels.StackLabel {
+		names = append(names, "stack")
+	}
+	if c.options.Labels.Tenants.enabled() {
+		names = append(names, c.options.Labels.Tenants.label)
+	}
+	return append(names, extra...)
+}
+
+// serviceLabelValues returns the label values identifying a service, followed by the extra ones
+func (c *DockerSwarmCollector) serviceLabelValues(service swarm.Service, extra ...string) []string {
+	values := []string{service.ID, c.options.Labels.serviceName(service)}
+	if c.options.Labels.StackLabel {
+		values = append(values, labelValue(service.Spec.Labels[stackNamespaceLabel]))
+	}
+	if c.options.Labels.Tenants.enabled() {
+		values = append(values, c.options.Labels.Tenants.tenant(service))
+	}
+	return append(values, extra...)
+}
+
+// serviceName returns the service_name label value of a service
+func (r labelRules) serviceName(service swarm.Service) string {
+	name := service.Spec.Name
+	if r.TrimStackPrefix || r.StackLabel {
+		if stack := service.Spec.Labels[stackNamespaceLabel]; stack != "" {
+			// Keep the full name when the stack prefix is all there is
+			if trimmed := strings.TrimPrefix(name, stack+"_"); trimmed != "" {
+				name = trimmed
+			}
+		}
+	}
+	return labelValue(name)
+}
+
+// nodeHostname returns the node_hostname label value of a node, its ID when the node reports no hostname
+func (r labelRules) nodeHostname(node swarm.Node) string {
+	return hostnameValue(node.Description.Hostname, node.ID)
+}
+
+// hostnameValue returns a hostname label value, falling back to the node ID when the hostname is empty
+func hostnameValue(hostname, nodeID string) string {
+	if hostname == "" {
+		return nodeID
+	}
+	return labelValue(hostname)
+}
+
+// maxMessageLength is the number of characters kept of the free-form messages exposed as label values
+const maxMessageLength = 200
+
+// messageValue turns a free-form message into a label value on a single line, cut to maxMessageLength characters
+func messageValue(message string) string {
+	message = strings.Join(strings.Fields(labelValue(message)), " ")
+	if runes := []rune(message); len(runes) > maxMessageLength {
+		message = string(runes[:maxMessageLength-1]) + "…"
+	}
+	return message
+}
+
+// labelValue replaces invalid UTF-8 sequences, which the Prometheus client refuses in label values
+func labelValue(value string) string {
+	return strings.ToValidUTF8(value, "\uFFFD")
+}
@@ -0,0 +1,229 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/swarm"
+	"github.com/docker/docker/pkg/stdcopy"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// logPattern is a named regular expression counted in the service logs
+type logPattern struct {
+	name string
+	re   *regexp.Regexp
+}
+
+// parseLogPatterns compiles the log patterns of the configuration file, in the order of their names
+func parseLogPatterns(patterns map[string]string) ([]logPattern, error) {
+	var compiled []logPattern
+	for _, name := range sortedKeys(patterns) {
+		re, err := regexp.Compile(patterns[name])
+		if err != nil {
+			return nil, fmt.Errorf("invalid log pattern %s: %w", name, err)
+		}
+		compiled = append(compiled, logPattern{name: name, re: re})
+	}
+	return compiled, nil
+}
+
+// serviceLogs holds how far the logs of a service were read and the lines matching each pattern
+type serviceLogs struct {
+	// read is the timestamp of the last line read, fetched when the logs were last fetched
+	read    time.Time
+	fetched time.Time
+	matches []uint64
+	seen    time.Time
+}
+
+// logTracker counts the log lines of every service matching the patterns across scrapes
+type logTracker struct {
+	mu       sync.Mutex
+	services map[string]*serviceLogs
+}
+
+// newLogTracker creates an empty tracker
+func newLogTracker() *logTracker {
+	return &logTracker{services: make(map[string]*serviceLogs)}
+}
+
+// clone returns a copy of the tracker sharing no state with it
+func (t *logTracker) clone() *logTracker {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	c := newLogTracker()
+	for service, l := range t.services {
+		copied := *l
+		copied.matches = slices.Clone(l.matches)
+		c.services[service] = &copied
+	}
+	return c
+}
+
+// due returns the state of a service when its logs were not fetched within the interval
+func (t *logTracker) due(service string, now time.Time, interval time.Duration, patterns int) (*serviceLogs, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	l, ok := t.services[service]
+	if !ok {
+		l = &serviceLogs{matches: make([]uint64, patterns)}
+		t.services[service] = l
+	}
+	l.seen = now
+	if !l.fetched.IsZero() && now.Sub(l.fetched) < interval {
+		return nil, false
+	}
+	return l, true
+}
+
+// record adds the lines read from the logs of a service, the first fetch only finding where to start from
+// The lines are not in time order, stdout coming before stderr and the tasks interleaved, so every line newer than
+// the previous fetch counts and the newest one read only moves forward afterwards
+func (t *logTracker) record(l *serviceLogs, now time.Time, lines []logLine, patterns []logPattern) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	first := l.fetched.IsZero()
+	l.fetched = now
+	read := l.read
+	for _, line := range lines {
+		// Since only has a precision of a second, the lines read before come again
+		if !line.timestamp.After(l.read) {
+			continue
+		}
+		if line.timestamp.After(read) {
+			read = line.timestamp
+		}
+		if first {
+			continue
+		}
+		for i, pattern := range patterns {
+			if pattern.re.MatchString(line.text) {
+				l.matches[i]++
+			}
+		}
+	}
+	l.read = read
+}
+
+// collect sends the matching lines of every service seen by pattern
+func (t *logTracker) collect(ch chan<- prometheus.Metric, desc *metricDesc, patterns []logPattern, labels func(service string) []string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for _, service := range sortedKeys(t.services) {
+		values := labels(service)
+		if values == nil {
+			continue
+		}
+		for i, pattern := range patterns {
+			desc.counter(ch, float64(t.services[service].matches[i]), append(values, pattern.name)...)
+		}
+	}
+}
+
+// prune forgets the services not observed for a while
+func (t *logTracker) prune(now time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for service, l := range t.services {
+		if now.Sub(l.seen) > outageTrackerRetention {
+			delete(t.services, service)
+		}
+	}
+}
+
+// logLine is a line of the logs of a service with its timestamp
+type logLine struct {
+	timestamp time.Time
+	text      string
+}
+
+// readLogLines splits logs requested with timestamps into lines, demultiplexing them unless the service has a TTY
+func readLogLines(logs io.Reader, tty bool) ([]logLine, error) {
+	if !tty {
+		var stdout, stderr bytes.Buffer
+		if _, err := stdcopy.StdCopy(&stdout, &stderr, logs); err != nil {
+			return nil, err
+		}
+		logs = io.MultiReader(&stdout, &stderr)
+	}
+
+	var lines []logLine
+	scanner := bufio.NewScanner(logs)
+	scanner.Buffer(nil, 1024*1024)
+	for scanner.Scan() {
+		stamp, text, _ := strings.Cut(scanner.Text(), " ")
+		timestamp, err := time.Parse(time.RFC3339Nano, stamp)
+		if err != nil {
+			continue
+		}
+		lines = append(lines, logLine{timestamp: timestamp, text: text})
+	}
+	return lines, scanner.Err()
+}
+
+// collectServiceLogMetrics counts the lines of the recent logs of the selected services matching the log patterns
+func (c *DockerSwarmCollector) collectServiceLogMetrics(s *scrape) {
+	services, err := s.services()
+	if err != nil {
+		return
+	}
+
+	selected := make(map[string]swarm.Service)
+	for _, service := range c.selectedServices(services) {
+		selected[service.ID] = service
+
+		state, due := c.logs.due(service.ID, s.started, c.options.LogInterval, len(c.options.LogPatterns))
+		if !due {
+			continue
+		}
+		options := container.LogsOptions{
+			ShowStdout: true,
+			ShowStderr: true,
+			Timestamps: true,
+			Tail:       strconv.Itoa(c.options.LogLines),
+		}
+		if !state.read.IsZero() {
+			options.Since = strconv.FormatInt(state.read.Unix(), 10)
+		}
+
+		logs, err := s.docker.ServiceLogs(s.ctx, service.ID, options)
+		if err != nil {
+			if unavailable(err) {
+				return
+			}
+			s.apiError("Error reading logs of service %s: %v", service.Spec.Name, err)
+			continue
+		}
+		tty := service.Spec.TaskTemplate.ContainerSpec != nil && service.Spec.TaskTemplate.ContainerSpec.TTY
+		lines, err := readLogLines(logs, tty)
+		logs.Close()
+		if err != nil {
+			s.apiError("Error reading logs of service %s: %v", service.Spec.Name, err)
+			continue
+		}
+		c.logs.record(state, s.started, lines, c.options.LogPatterns)
+	}
+
+	c.logs.collect(s.ch, c.serviceLogMatches, c.options.LogPatterns, func(id string) []string {
+		service, ok := selected[id]
+		if !ok {
+			return nil
+		}
+		return c.serviceLabelValues(service)
+	})
+	c.logs.prune(s.started)
+}
@@ -1,17 +1,21 @@
 package main
 
 import (
+	"cmp"
 	"context"
+	"crypto/tls"
 	"flag"
 	"fmt"
 	"log"
 	"net/http"
 	"os"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
 	"time"
 
-	"github.com/docker/docker/api/types"
 	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/filters"
 	"github.com/docker/docker/api/types/swarm"
 	"github.com/docker/docker/client"
 	"github.com/prometheus/client_golang/prometheus"
@@ -21,359 +25,1694 @@ import (
 var (
 	listenAddress = flag.String("web.listen-address", ":9323", "Address to listen on for web interface and telemetry.")
 	metricsPath   = flag.String("web.telemetry-path", "/metrics", "Path under which to expose metrics.")
-	dockerSocket  = flag.String("docker.socket", "unix:///var/run/docker.sock", "Docker socket path.")
+	dockerSocket  = flag.String("docker.socket", defaultDockerSocket(), "Docker socket path.")
+	dockerFixture = flag.String("docker.fixture", "", "Directory of canned JSON responses served instead of a Docker daemon.")
+	socketProxy   = flag.Bool("docker.socket-proxy", false, "Skip the Docker API calls a socket proxy denies instead of failing the scrapes.")
+	checkInterval = flag.Duration("docker.self-check-interval", 5*time.Minute, "Interval between two checks of the Docker API endpoints the exporter relies on, 0 to only check them at startup.")
+	proxyCalls    = stringSlice("docker.socket-proxy.calls", "Docker API call the socket proxy allows, e.g. ServiceList; the others are never made (repeatable, comma-separated, default all).")
 	scrapeTimeout = flag.Duration("scrape.timeout", 10*time.Second, "Timeout for scraping Docker metrics.")
+	scrapeMargin  = flag.Duration("scrape.deadline-margin", time.Second, "Stop starting sub-collectors when less than this is left before the scrape timeout.")
+	adaptiveSkip  = flag.Bool("scrape.adaptive-skip", true, "Skip the optional sub-collectors that recently took longer than the time left in the scrape.")
 	showVersion   = flag.Bool("version", false, "Show version information and exit.")
+	configFile    = flag.String("config.file", "", "Path to the YAML configuration file.")
+	replay        = flag.String("replay", "", "Serve metrics from a state bundle written by dump-state instead of a live daemon.")
+
+	bearerTokenFile = flag.String("web.bearer-token-file", "", "File holding the bearer token required on the metrics, status, scrape trace and JSON API endpoints, e.g. a Docker secret.")
+	tlsCertFile     = flag.String("web.tls-cert-file", "", "Certificate file of the web server, enables HTTPS; reloaded when it changes.")
+	tlsKeyFile      = flag.String("web.tls-key-file", "", "Private key file of the web server certificate.")
+	rateLimitRate   = flag.Float64("web.rate-limit", 0, "Requests per second each source address may make to the metrics, status, scrape trace and JSON API endpoints, answering the others with 429 (0 disables).")
+	rateLimitBurst  = flag.Int("web.rate-limit.burst", 10, "Requests a source address may make at once before --web.rate-limit applies.")
+	corsOrigins     = stringSlice("web.cors-origin", "Origin whose browser pages may call the JSON API, or * for any (repeatable, comma-separated).")
+	allowCIDRs      = stringSlice("web.allow-cidr", "Network in CIDR notation, or single address, allowed to reach the exporter's endpoints (repeatable, comma-separated).")
+
+	tlsMinVersion   = flag.String("tls.min-version", "TLS12", "Minimum TLS version of the web server and the Docker clients of clusters: TLS10, TLS11, TLS12 or TLS13.")
+	tlsCipherSuites = stringSlice("tls.cipher-suites", "Cipher suite allowed up to TLS 1.2 by the web server and the Docker clients of clusters, e.g. TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256 (repeatable, comma-separated, default Go's).")
+	tlsCurves       = stringSlice("tls.curves", "Curve preferred for key exchange by the web server and the Docker clients of clusters: X25519, P256, P384, P521 or X25519MLKEM768 (repeatable, comma-separated, default Go's).")
+
+	collectNetworkAttachments = flag.Bool("collect.service.network-attachments", false, "Expose one docker_service_network_attachment series per service network.")
+	collectBindMounts         = flag.Bool("collect.service.bind-mounts", false, "Expose one docker_service_bind_mount series per host path bind-mounted into a service.")
+	collectSecretNames        = flag.String("collect.secrets.names", "", "Regular expression of the secret names whose creation time is exposed on docker_swarm_secret_created_timestamp_seconds.")
+	collectConfigNames        = flag.String("collect.configs.names", "", "Regular expression of the config names whose creation time is exposed on docker_swarm_config_created_timestamp_seconds.")
+	collectSecretReferences   = flag.Bool("collect.service.secret-references", false, "Expose one docker_service_secret_reference or docker_service_config_reference series per secret and config of a service.")
+
+	probeIngress        = flag.Bool("probe.ingress", false, "Probe a sample of ingress-published TCP ports on the local node.")
+	probeIngressAddress = flag.String("probe.ingress.address", "127.0.0.1", "Address used to reach ingress-published ports on the local node.")
+	probeIngressSample  = flag.Int("probe.ingress.sample", 5, "Maximum number of ingress-published ports probed per scrape.")
+	probeIngressTimeout = flag.Duration("probe.ingress.timeout", 2*time.Second, "Timeout for each ingress port probe.")
+
+	probeServices        = flag.Bool("probe.services", false, "Probe the published ports of the services listed in service_probes or labeled swarm-exporter.probe on the local node.")
+	probeServicesAddress = flag.String("probe.services.address", "127.0.0.1", "Address used to reach the published ports of the probed services.")
+	probeServicesTimeout = flag.Duration("probe.services.timeout", 5*time.Second, "Timeout for the service probes of a scrape.")
+
+	probeDNS        = flag.Bool("probe.dns", false, "Resolve <service> and tasks.<service> for every service from the exporter's network namespace.")
+	probeDNSTimeout = flag.Duration("probe.dns.timeout", 2*time.Second, "Timeout for the DNS lookups of a scrape.")
+
+	logLines    = flag.Int("collect.service-logs.lines", 100, "Maximum number of log lines read per service and fetch when log_patterns are configured.")
+	logInterval = flag.Duration("collect.service-logs.interval", time.Minute, "Minimum time between two fetches of the logs of a service.")
+
+	legacyNames     = flag.Bool("metrics.legacy-names", false, "Also expose metrics under their names from before the naming cleanup.")
+	stripHelp       = flag.Bool("metrics.strip-help", false, "Leave the HELP text out of the exposed metrics to shrink the payload.")
+	trimStackPrefix = flag.Bool("metrics.trim-stack-prefix", false, "Remove the <stack>_ prefix from the service_name label of services deployed with docker stack deploy.")
+	stackLabel      = flag.Bool("metrics.stack-label", false, "Add the stack label to per-service metrics and remove the <stack>_ prefix from service_name.")
+
+	healthFailureWindow   = flag.Duration("health.failure-window", 5*time.Minute, "How far back failed tasks count against docker_service_healthy.")
+	healthMaxFailures     = flag.Int("health.max-failures", 2, "Number of failed tasks within the failure window a healthy service may have.")
+	healthUpdatingHealthy = flag.Bool("health.updating-healthy", true, "Keep a service healthy while it misses tasks during an update or rollback.")
+
+	healthCrashLoopWindow   = flag.Duration("health.crashloop-window", 5*time.Minute, "How far back restarted tasks count towards docker_service_restarts_window.")
+	healthCrashLoopRestarts = flag.Int("health.crashloop-restarts", 3, "Number of restarted tasks within the crash-loop window from which docker_service_crashlooping is 1.")
+
+	historyRetention  = flag.Duration("history.retention", 0, "How long the in-memory history served by /api/v1/range keeps samples (0 disables).")
+	historyResolution = flag.Duration("history.resolution", 30*time.Second, "Interval between two samples of the in-memory history.")
+	historyMetrics    = stringSlice("history.metrics", "Metric family kept by the in-memory history (repeatable, comma-separated, default docker_up, docker_tasks_running, docker_tasks_desired, docker_nodes_active and docker_service_healthy).")
+
+	haService = flag.String("ha.service", "", "Name of the exporter service; only the replica on the running node with the lowest ID exposes swarm metrics.")
+
+	aggregatorDiscoveryName     = flag.String("aggregator.discovery-name", "", "DNS name resolving to the agent instances, usually tasks.<exporter-service>; enables aggregator mode.")
+	aggregatorAgentPort         = flag.Int("aggregator.agent-port", 9323, "Port the agent instances listen on.")
+	aggregatorDiscoveryInterval = flag.Duration("aggregator.discovery-interval", 30*time.Second, "Interval between two discoveries of the agent instances.")
+	aggregatorDiscoveryTimeout  = flag.Duration("aggregator.discovery-timeout", 5*time.Second, "Timeout for resolving and connecting to the agent instances.")
+
+	aggregatorAgentCAFile     = flag.String("aggregator.agent-tls-ca-file", "", "CA certificate file verifying the agents, which are fetched over HTTPS when the exporter serves TLS (default: system roots).")
+	aggregatorAgentServerName = flag.String("aggregator.agent-tls-server-name", "", "Server name expected in the certificates of the agents, instead of their address.")
+
+	clusterName = flag.String("cluster.name", "", "Name of the swarm cluster, added as the cluster_name label to swarm metrics.")
+
+	failureMode  = flag.String("collect.failure-mode", failureModeDrop, "What to expose when a Docker API call fails: \"drop\" exposes only docker_up, \"stale\" serves the metrics of the last successful scrape.")
+	maxStaleness = flag.Duration("collect.failure-mode.max-staleness", 0, "How long the stale failure mode serves the metrics of the last successful scrape, 0 for as long as the failures last.")
+
+	stacksInclude = flag.String("collect.stacks.include", "", "Regular expression of stack namespaces whose services produce per-service metrics.")
+	stacksExclude = flag.String("collect.stacks.exclude", "", "Regular expression of stack namespaces whose services produce no per-service metrics.")
+	nodesInclude  = stringSlice("collect.nodes.include", "Hostname expression or label:key=value selecting nodes that produce per-node metrics (repeatable).")
+	nodesExclude  = stringSlice("collect.nodes.exclude", "Hostname expression or label:key=value selecting nodes that produce no per-node metrics (repeatable).")
+
+	shardCount = flag.Int("shard.count", 1, "Number of exporter instances sharing the per-service metrics of the swarm.")
+	shardIndex = flag.Int("shard.index", 0, "Index of this instance among the shards, from 0 to shard.count-1.")
+
+	collectProfile = flag.String("collect.profile", "standard", "Preset of collector flags, those given on the command line taking precedence: minimal for cluster-wide counts only, standard or full for every optional per-object series.")
+	lowResource    = flag.Bool("low-resource", false, "Tune the exporter for small edge managers: no per-task series, fewer log lines, less frequent background fetches and a 24MiB Go memory limit unless GOMEMLIMIT is set.")
+
+	taskSlots   = flag.Bool("collect.tasks.slots", false, "Expose docker_task_slot_state with the state of the latest task of every slot of replicated services.")
+	taskHistory = flag.Bool("collect.tasks.history", true, "List the tasks no longer desired to be running, which failure-based health and the status page rely on.")
+
+	localDisabled = flag.Bool("collector.local.disabled", false, "Skip container and image metrics of the local daemon and only collect swarm metrics.")
+
+	nodeLabels = stringSlice("collect.node-labels", "Node or engine label exposed on docker_node_labels (repeatable, comma-separated).")
+
+	containersSecurity    = flag.Bool("collect.containers.security", false, "Inspect every running container of the local daemon to count privileged ones, added capabilities and host namespaces.")
+	containersHealth      = flag.Bool("collect.containers.healthchecks", false, "Inspect the running containers of the local daemon with a healthcheck to expose the duration and failures of their probes.")
+	containersIgnoreLabel = stringSlice("collect.containers.ignore-label", "Ignore containers carrying the label key=value, or key with any value (repeatable).")
 )
 
+// CollectorOptions controls what the DockerSwarmCollector collects
+type CollectorOptions struct {
+	// Timeout bounds the Docker API calls made during a single scrape
+	Timeout time.Duration
+
+	// SocketProxy skips the Docker API calls denied by a socket proxy, or not among the ProxyCalls when given
+	SocketProxy bool
+	ProxyCalls  []string
+
+	// Budgets bounds the time of sub-collectors, as a percentage of the timeout by name
+	Budgets map[string]float64
+
+	// DeadlineMargin is the time left before the timeout under which no further sub-collector starts
+	DeadlineMargin time.Duration
+
+	// AdaptiveSkip skips the optional sub-collectors expected to take longer than the time left in the scrape
+	AdaptiveSkip bool
+
+	// NetworkAttachments enables the per-network service attachment info series
+	NetworkAttachments bool
+
+	// BindMounts enables the per-source service bind mount info series
+	BindMounts bool
+
+	// SecretReferences enables the per-secret and per-config service reference info series
+	SecretReferences bool
+
+	// SecretNames and ConfigNames allowlist the secrets and configs whose creation time is exposed, nil for none
+	SecretNames *regexp.Regexp
+	ConfigNames *regexp.Regexp
+
+	// IngressProbe enables connecting to ingress-published ports on the local node
+	IngressProbe        bool
+	IngressProbeAddress string
+	IngressProbeSample  int
+	IngressProbeTimeout time.Duration
+
+	// ServiceProbe enables probing the published ports of the ServiceProbes services, keyed by name,
+	// and of the services labeled for it
+	ServiceProbe        bool
+	ServiceProbes       map[string]serviceProbeConfig
+	ServiceProbeAddress string
+	ServiceProbeTimeout time.Duration
+
+	// DNSProbe enables resolving service names through the swarm DNS server
+	DNSProbe        bool
+	DNSProbeTimeout time.Duration
+
+	// LogPatterns enables counting the service log lines matching them, reading at most LogLines lines per service
+	// and LogInterval
+	LogPatterns []logPattern
+	LogLines    int
+	LogInterval time.Duration
+
+	// Stacks selects the services that produce per-service and per-task metrics
+	Stacks stackFilter
+
+	// Shard selects the services handled by this instance when several share the swarm
+	Shard shardFilter
+
+	// Nodes selects the nodes that produce per-node metrics
+	Nodes nodeFilter
+
+	// ActiveTasksOnly lists only the tasks desired to be running, leaving out the task history
+	ActiveTasksOnly bool
+
+	// TaskSlots enables the per-slot task state series of replicated services
+	TaskSlots bool
+
+	// IgnoredContainers excludes containers from the local container metrics
+	IgnoredContainers containerLabelFilter
+
+	// LocalDisabled skips the container and image metrics of the local daemon
+	LocalDisabled bool
+
+	// ContainerSecurity inspects the running containers of the local daemon for elevated privileges
+	ContainerSecurity bool
+
+	// ContainerHealthchecks inspects the running containers of the local daemon with a healthcheck for their probes
+	ContainerHealthchecks bool
+
+	// LegacyNames also exposes renamed metrics under their previous names
+	LegacyNames bool
+
+	// MetricNames maps the names of metric families to the custom names they are exposed under
+	MetricNames map[string]string
+
+	// FailureMode selects what is exposed when a Docker API call fails
+	FailureMode string
+
+	// MaxStaleness bounds the age of the metrics served by the stale failure mode, zero for no bound
+	MaxStaleness time.Duration
+
+	// Health decides when a service counts as healthy
+	Health healthRules
+
+	// HAService is the exporter service whose replicas elect a single active one
+	HAService string
+
+	// SwarmManager is false when the daemon was not a swarm manager at startup,
+	// the swarm families are then neither described nor collected
+	SwarmManager bool
+
+	// ClusterID and ClusterName identify the swarm on every swarm metric
+	ClusterID   string
+	ClusterName string
+
+	// NodeLabels lists the node and engine labels exposed on docker_node_labels
+	NodeLabels []string
+
+	// Labels normalizes the label values taken from Docker object names
+	Labels labelRules
+}
+
 // DockerSwarmCollector implements the prometheus.Collector interface
 type DockerSwarmCollector struct {
-	dockerClient *client.Client
-	timeout      time.Duration
+	docker  dockerAPI
+	timeout time.Duration
+	options CollectorOptions
+
+	// collectors are the enabled sub-collectors in the order they run
+	collectors []subCollector
+
+	// descs holds every metric family in registration order
+	descs []*metricDesc
+
+	// cache holds the metrics of the last successful scrape
+	cache *scrapeCache
+
+	// availability, outages, deployments and startups keep the service history across scrapes
+	availability *availabilityTracker
+	outages      *outageTracker
+	deployments  *deploymentTracker
+	startups     *startupTracker
+	restarts     *restartTracker
+
+	// probes counts the failed healthcheck probes of the local containers across scrapes
+	probes *probeTracker
+
+	// logs keeps how far the service logs were read and the lines matching the log patterns
+	logs *logTracker
+
+	// leaders counts the raft leader changes across scrapes, nodes keeps the node history
+	leaders *leaderTracker
+	nodes   *nodeTracker
+
+	// durations keeps the recent durations and skips of the sub-collectors
+	durations *collectorDurations
+
+	// parseWarnings counts the API objects missing a field across scrapes
+	parseWarnings *parseWarningCounter
+
+	// capabilities tracks the Docker API calls allowed by the socket proxy, nil outside socket proxy mode
+	capabilities *capabilities
+
+	// selfCheck checks the Docker API endpoints the collector relies on
+	selfCheck *endpointChecker
 
 	// Metrics
-	containersRunning         *prometheus.Desc
-	containersStopped         *prometheus.Desc
-	containersPaused          *prometheus.Desc
-	imagesCount               *prometheus.Desc
-	servicesCount             *prometheus.Desc
-	tasksRunning              *prometheus.Desc
-	tasksDesired              *prometheus.Desc
-	nodesCount                *prometheus.Desc
-	nodesActive               *prometheus.Desc
-	stacksCount               *prometheus.Desc
-	containersRunningAllNodes *prometheus.Desc
-	totalContainersAllNodes   *prometheus.Desc
+	containersRunning            *metricDesc
+	containersStopped            *metricDesc
+	containersPaused             *metricDesc
+	imagesCount                  *metricDesc
+	servicesCount                *metricDesc
+	tasksRunning                 *metricDesc
+	tasksDesired                 *metricDesc
+	nodesCount                   *metricDesc
+	nodesActive                  *metricDesc
+	stacksCount                  *metricDesc
+	containersRunningAllNodes    *metricDesc
+	totalContainersAllNodes      *metricDesc
+	serviceNetworks              *metricDesc
+	serviceNetworkCount          *metricDesc
+	serviceNetworkAttachment     *metricDesc
+	serviceHostNetwork           *metricDesc
+	nodePublishedPorts           *metricDesc
+	nodePublishedPortConflicts   *metricDesc
+	ingressPortReachable         *metricDesc
+	networksCount                *metricDesc
+	serviceDNSRecords            *metricDesc
+	secretCreated                *metricDesc
+	configCreated                *metricDesc
+	serviceProbeSuccess          *metricDesc
+	serviceProbeDuration         *metricDesc
+	serviceProbeStatusCode       *metricDesc
+	serviceDNSDuration           *metricDesc
+	serviceLBBackends            *metricDesc
+	serviceRestartPolicy         *metricDesc
+	serviceHealthcheckConfigured *metricDesc
+	serviceSecrets               *metricDesc
+	serviceConfigs               *metricDesc
+	serviceSecretReference       *metricDesc
+	serviceConfigReference       *metricDesc
+	servicePublishedPorts        *metricDesc
+	serviceMounts                *metricDesc
+	serviceCapabilityAdded       *metricDesc
+	serviceBindMount             *metricDesc
+	taskSlotState                *metricDesc
+	serviceUpdateConfig          *metricDesc
+	serviceUpdateParallelism     *metricDesc
+	serviceUpdateDelay           *metricDesc
+	serviceUpdateMonitor         *metricDesc
+	serviceUpdateMaxFailureRatio *metricDesc
+	containersByState            *metricDesc
+	containersPrivileged         *metricDesc
+	containersCapabilitiesAdded  *metricDesc
+	containersHostNamespace      *metricDesc
+	containersUnconfined         *metricDesc
+	containerProbeDuration       *metricDesc
+	containerProbeFailures       *metricDesc
+	engineSecurityOption         *metricDesc
+	engineIsolation              *metricDesc
+	serviceCreated               *metricDesc
+	serviceUpdated               *metricDesc
+	nodeLabels                   *metricDesc
+	managersCount                *metricDesc
+	managersReachable            *metricDesc
+	engineVersions               *metricDesc
+	nodesByEngineVersion         *metricDesc
+	duplicateHostnames           *metricDesc
+	nodeDuplicateHostname        *metricDesc
+	nodeStatusChanged            *metricDesc
+	nodeDowns                    *metricDesc
+	nodeDowntime                 *metricDesc
+	nodeDrainDuration            *metricDesc
+	serviceUpdateState           *metricDesc
+	serviceUpdateProgress        *metricDesc
+	serviceUpdateFailed          *metricDesc
+	serviceUpdateFailure         *metricDesc
+	serviceHealthy               *metricDesc
+	serviceRestarts              *metricDesc
+	serviceCrashLooping          *metricDesc
+	serviceLastTaskError         *metricDesc
+	serviceTaskExits             *metricDesc
+	serviceLogMatches            *metricDesc
+	serviceAvailability          *metricDesc
+	serviceLastZeroReplicas      *metricDesc
+	serviceDeployments           *metricDesc
+	serviceRolloutDuration       *metricDesc
+	containerStartDuration       *metricDesc
+	up                           *metricDesc
+	dataStale                    *metricDesc
+	lastSuccess                  *metricDesc
+	isActive                     *metricDesc
+	nodeInfo                     *metricDesc
+	swarmManager                 *metricDesc
+	swarmInfo                    *metricDesc
+	scrapeTruncated              *metricDesc
+	collectorSkipped             *metricDesc
+	parseWarningsTotal           *metricDesc
+	callAllowed                  *metricDesc
+	endpointAllowed              *metricDesc
+	endpointFailure              *metricDesc
+
+	// Swarm control plane
+	clusterCreated                 *metricDesc
+	clusterUpdated                 *metricDesc
+	leaderChanges                  *metricDesc
+	managerInfo                    *metricDesc
+	raftSnapshotInterval           *metricDesc
+	raftKeepOldSnapshots           *metricDesc
+	raftLogEntriesForSlowFollowers *metricDesc
+	raftHeartbeatTick              *metricDesc
+	raftElectionTick               *metricDesc
+	taskHistoryRetentionLimit      *metricDesc
+	dispatcherHeartbeatPeriod      *metricDesc
+	nodeCertExpiry                 *metricDesc
+	autolockManagers               *metricDesc
+
+	// nodeLabelKeys are the allowlisted node labels, in the order of the nodeLabels label names
+	nodeLabelKeys []string
 }
 
 // NewDockerSwarmCollector creates a new DockerSwarmCollector
-func NewDockerSwarmCollector(dockerClient *client.Client, timeout time.Duration) *DockerSwarmCollector {
-	return &DockerSwarmCollector{
-		dockerClient: dockerClient,
-		timeout:      timeout,
-
-		containersRunning: prometheus.NewDesc(
-			"docker_containers_running_total",
-			"The number of containers running",
-			nil, nil,
-		),
-		containersStopped: prometheus.NewDesc(
-			"docker_containers_stopped_total",
-			"The number of containers stopped",
-			nil, nil,
-		),
-		containersPaused: prometheus.NewDesc(
-			"docker_containers_paused_total",
-			"The number of containers paused",
-			nil, nil,
-		),
-		imagesCount: prometheus.NewDesc(
-			"docker_images_total",
-			"The number of images",
-			nil, nil,
-		),
-		servicesCount: prometheus.NewDesc(
-			"docker_services_total",
-			"The number of services",
-			nil, nil,
-		),
-		tasksRunning: prometheus.NewDesc(
-			"docker_tasks_running_total",
-			"The number of tasks running",
-			[]string{"service_name"}, nil,
-		),
-		tasksDesired: prometheus.NewDesc(
-			"docker_tasks_desired_total",
-			"The number of tasks desired",
-			[]string{"service_name"}, nil,
-		),
-		nodesCount: prometheus.NewDesc(
-			"docker_nodes_total",
-			"The number of nodes",
-			nil, nil,
-		),
-		nodesActive: prometheus.NewDesc(
-			"docker_nodes_active_total",
-			"The number of active nodes",
-			nil, nil,
-		),
-		stacksCount: prometheus.NewDesc(
-			"docker_stacks_total",
-			"The number of stacks",
-			nil, nil,
-		),
-		containersRunningAllNodes: prometheus.NewDesc(
-			"docker_containers_running_all_nodes_total",
-			"The number of containers running across all nodes",
-			[]string{"node_id", "node_hostname"}, nil,
-		),
-		totalContainersAllNodes: prometheus.NewDesc(
-			"docker_containers_running_total_all_nodes",
-			"The total number of containers running across all nodes combined",
-			nil, nil,
-		),
+func NewDockerSwarmCollector(docker dockerAPI, options CollectorOptions) *DockerSwarmCollector {
+	c := &DockerSwarmCollector{
+		docker:       docker,
+		timeout:      options.Timeout,
+		options:      options,
+		cache:        &scrapeCache{},
+		availability: newAvailabilityTracker(),
+		outages:      newOutageTracker(),
+		deployments:  newDeploymentTracker(),
+		startups:     newStartupTracker(),
+		restarts:     newRestartTracker(),
+		probes:       newProbeTracker(),
+		logs:         newLogTracker(),
+		leaders:      &leaderTracker{},
+		nodes:        newNodeTracker(),
+		durations:    newCollectorDurations(),
+
+		parseWarnings: newParseWarningCounter(),
+	}
+	c.collectors = c.subCollectors()
+
+	if options.SocketProxy {
+		c.capabilities = newCapabilities(options.ProxyCalls)
+		c.docker = proxyDocker{api: docker, caps: c.capabilities}
+	}
+	// The self-check calls the endpoints even when the socket proxy mode stopped making them, and makes them again
+	// once they answer
+	c.selfCheck = newEndpointChecker(docker, c.capabilities, options.Timeout)
+
+	c.up = c.newDesc(
+		"docker_up",
+		"Whether the last scrape of the Docker API succeeded",
+		nil,
+	)
+	c.dataStale = c.newDesc(
+		"docker_exporter_data_stale",
+		"Whether the exposed metrics are cached from an earlier successful scrape",
+		nil,
+	)
+	c.lastSuccess = c.newDesc(
+		"docker_exporter_last_success_timestamp_seconds",
+		"The time of the last successful scrape of the Docker API, in seconds since the Unix epoch",
+		nil,
+	)
+	c.isActive = c.newDesc(
+		"docker_exporter_is_active",
+		"Whether this exporter replica exposes the swarm metrics (1) or stands by (0)",
+		nil,
+	)
+	c.scrapeTruncated = c.newDesc(
+		"docker_exporter_scrape_truncated",
+		"Whether sub-collectors were skipped because the scrape was about to time out",
+		nil,
+	)
+	c.collectorSkipped = c.newDesc(
+		"docker_exporter_collector_skipped_total",
+		"The number of scrapes that skipped a sub-collector, because the scrape was about to time out or the sub-collector was expected to take longer than the time left",
+		[]string{"collector", "reason"},
+	)
+	c.parseWarningsTotal = c.newDesc(
+		"docker_exporter_parse_warnings_total",
+		"The number of Docker API objects missing a field the exporter relies on, which was given a fallback value",
+		[]string{"object", "field"},
+	)
+	c.callAllowed = c.newDesc(
+		"docker_exporter_docker_call_allowed",
+		"Whether the socket proxy allows a Docker API call, in socket proxy mode",
+		[]string{"call"},
+	)
+	c.endpointAllowed = c.newDesc(
+		"docker_exporter_endpoint_allowed",
+		"Whether the latest self-check of a Docker API endpoint the exporter relies on succeeded",
+		[]string{"call", "endpoint"},
+	)
+	c.endpointFailure = c.newDesc(
+		"docker_exporter_endpoint_failure_info",
+		"The error of the latest self-check of a Docker API endpoint that failed",
+		[]string{"call", "endpoint", "message"},
+	)
+	c.nodeInfo = c.newDesc(
+		nodeInfoFamily,
+		"Information about the node of the local Docker daemon",
+		[]string{"node_id", "node_hostname"},
+	)
+	c.swarmManager = c.newDesc(
+		"docker_swarm_manager",
+		"Whether the local Docker daemon is a swarm manager and exposes the swarm metrics",
+		nil,
+	)
+	c.swarmInfo = c.newDesc(
+		"docker_swarm_info",
+		"The place of the local Docker daemon in the swarm, always 1",
+		[]string{"cluster_id", "node_id", "node_addr", "local_node_state", "control_available"},
+	)
+	c.containersRunning = c.newLegacyDesc(
+		"docker_containers_running", "docker_containers_running_total",
+		"The number of containers running",
+		nil,
+	)
+	c.containersStopped = c.newLegacyDesc(
+		"docker_containers_stopped", "docker_containers_stopped_total",
+		"The number of containers stopped",
+		nil,
+	)
+	c.containersPaused = c.newLegacyDesc(
+		"docker_containers_paused", "docker_containers_paused_total",
+		"The number of containers paused",
+		nil,
+	)
+	c.containersByState = c.newDesc(
+		"docker_containers_by_state",
+		"The number of containers in each state",
+		[]string{"state"},
+	)
+	c.containerProbeDuration = c.newDesc(
+		"docker_container_health_probe_duration_seconds",
+		"The duration of the latest healthcheck probe of a running container",
+		[]string{"container_name", "service_name"},
+	)
+	c.containerProbeFailures = c.newDesc(
+		"docker_container_health_probe_failures_total",
+		"The number of failed healthcheck probes of a running container since the exporter started",
+		[]string{"container_name", "service_name"},
+	)
+	c.containersPrivileged = c.newDesc(
+		"docker_containers_privileged",
+		"The number of running containers in privileged mode",
+		nil,
+	)
+	c.containersCapabilitiesAdded = c.newDesc(
+		"docker_containers_capabilities_added",
+		"The number of running containers with added Linux capabilities",
+		nil,
+	)
+	c.containersHostNamespace = c.newDesc(
+		"docker_containers_host_namespace",
+		"The number of running containers sharing a namespace with the host",
+		[]string{"namespace"},
+	)
+	c.containersUnconfined = c.newDesc(
+		"docker_containers_unconfined",
+		"The number of running containers opting out of a confinement the daemon applies by default",
+		[]string{"profile"},
+	)
+	c.engineSecurityOption = c.newDesc(
+		"docker_engine_security_option",
+		"Whether the local Docker daemon runs with a security option",
+		[]string{"option"},
+	)
+	c.engineIsolation = c.newDesc(
+		"docker_engine_isolation_info",
+		"Always 1, carrying the operating system of the local Docker daemon and the isolation of its containers",
+		[]string{"os_type", "isolation"},
+	)
+	c.imagesCount = c.newLegacyDesc(
+		"docker_images", "docker_images_total",
+		"The number of images",
+		nil,
+	)
+	c.servicesCount = c.newLegacySwarmDesc(
+		"docker_services", "docker_services_total",
+		"The number of services",
+		nil,
+	)
+	c.tasksRunning = c.newLegacySwarmDesc(
+		"docker_tasks_running", "docker_tasks_running_total",
+		"The number of tasks running",
+		c.serviceLabelNames(),
+	)
+	c.tasksDesired = c.newLegacySwarmDesc(
+		"docker_tasks_desired", "docker_tasks_desired_total",
+		"The number of tasks desired",
+		c.serviceLabelNames(),
+	)
+	c.nodesCount = c.newLegacySwarmDesc(
+		"docker_nodes", "docker_nodes_total",
+		"The number of nodes",
+		nil,
+	)
+	c.nodesActive = c.newLegacySwarmDesc(
+		"docker_nodes_active", "docker_nodes_active_total",
+		"The number of active nodes",
+		nil,
+	)
+	c.managersCount = c.newSwarmDesc(
+		"docker_nodes_managers",
+		"The number of manager nodes",
+		nil,
+	)
+	c.managersReachable = c.newSwarmDesc(
+		"docker_nodes_managers_reachable",
+		"The number of manager nodes reachable by the raft consensus",
+		nil,
+	)
+	c.engineVersions = c.newSwarmDesc(
+		"docker_nodes_engine_versions",
+		"The number of distinct Docker Engine versions across the nodes",
+		nil,
+	)
+	c.nodesByEngineVersion = c.newSwarmDesc(
+		"docker_nodes_by_engine_version",
+		"The number of nodes running each Docker Engine version",
+		[]string{"version"},
+	)
+	c.nodeStatusChanged = c.newSwarmDesc(
+		"docker_node_status_changed_timestamp_seconds",
+		"The last time the state or availability of a node changed, in seconds since the Unix epoch",
+		[]string{"node_id", "node_hostname"},
+	)
+	c.nodeDowns = c.newSwarmDesc(
+		"docker_node_down_total",
+		"The number of times a node was observed leaving the ready state since the exporter started",
+		[]string{"node_id", "node_hostname"},
+	)
+	c.nodeDowntime = c.newSwarmDesc(
+		"docker_node_down_seconds_total",
+		"The time a node was observed not ready since the exporter started",
+		[]string{"node_id", "node_hostname"},
+	)
+	c.nodeDrainDuration = c.newSwarmDesc(
+		"docker_node_drain_duration_seconds",
+		"The time since a drained node was drained, only exposed while it is drained",
+		[]string{"node_id", "node_hostname"},
+	)
+	c.duplicateHostnames = c.newSwarmDesc(
+		"docker_nodes_duplicate_hostnames",
+		"The number of hostnames reported by more than one node",
+		nil,
+	)
+	c.nodeDuplicateHostname = c.newSwarmDesc(
+		"docker_node_duplicate_hostname",
+		"Node reporting a hostname that another node reports as well, always 1",
+		[]string{"node_id", "node_hostname"},
+	)
+	c.clusterCreated = c.newSwarmDesc(
+		"docker_swarm_cluster_created_timestamp_seconds",
+		"The time the swarm was created, in seconds since the Unix epoch",
+		nil,
+	)
+	c.clusterUpdated = c.newSwarmDesc(
+		"docker_swarm_cluster_updated_timestamp_seconds",
+		"The time the swarm was last updated, in seconds since the Unix epoch",
+		nil,
+	)
+	c.leaderChanges = c.newSwarmDesc(
+		"docker_swarm_leader_changes_total",
+		"The number of raft leader changes observed since the exporter started",
+		nil,
+	)
+	c.managerInfo = c.newSwarmDesc(
+		"docker_swarm_manager_info",
+		"Manager node with the address other nodes reach its raft endpoint at, always 1",
+		[]string{"node_id", "addr"},
+	)
+	c.raftSnapshotInterval = c.newSwarmDesc(
+		"docker_swarm_raft_snapshot_interval",
+		"The number of raft log entries between snapshots",
+		nil,
+	)
+	c.raftKeepOldSnapshots = c.newSwarmDesc(
+		"docker_swarm_raft_keep_old_snapshots",
+		"The number of raft snapshots kept beyond the current one",
+		nil,
+	)
+	c.raftLogEntriesForSlowFollowers = c.newSwarmDesc(
+		"docker_swarm_raft_log_entries_for_slow_followers",
+		"The number of raft log entries kept after a snapshot to sync up slow followers",
+		nil,
+	)
+	c.raftHeartbeatTick = c.newSwarmDesc(
+		"docker_swarm_raft_heartbeat_tick",
+		"The number of ticks between heartbeats of the raft leader, a tick being one second",
+		nil,
+	)
+	c.raftElectionTick = c.newSwarmDesc(
+		"docker_swarm_raft_election_tick",
+		"The number of ticks without a message from the raft leader before a follower starts an election",
+		nil,
+	)
+	c.taskHistoryRetentionLimit = c.newSwarmDesc(
+		"docker_swarm_task_history_retention_limit",
+		"The number of finished tasks kept per slot or node, negative when they are never removed",
+		nil,
+	)
+	c.dispatcherHeartbeatPeriod = c.newSwarmDesc(
+		"docker_swarm_dispatcher_heartbeat_period_seconds",
+		"How often nodes send heartbeats to the managers",
+		nil,
+	)
+	c.nodeCertExpiry = c.newSwarmDesc(
+		"docker_swarm_node_cert_expiry_seconds",
+		"The validity of the node certificates issued by the swarm CA",
+		nil,
+	)
+	c.autolockManagers = c.newSwarmDesc(
+		"docker_swarm_autolock_managers",
+		"Whether managers need the unlock key to start after a restart",
+		nil,
+	)
+	c.stacksCount = c.newLegacySwarmDesc(
+		"docker_stacks", "docker_stacks_total",
+		"The number of stacks",
+		nil,
+	)
+	c.containersRunningAllNodes = c.newLegacySwarmDesc(
+		"docker_node_containers_running", "docker_containers_running_all_nodes_total",
+		"The number of containers running on each node",
+		[]string{"node_id", "node_hostname"},
+	)
+	c.totalContainersAllNodes = c.newLegacySwarmDesc(
+		"docker_swarm_containers_running", "docker_containers_running_total_all_nodes",
+		"The total number of containers running across all nodes combined",
+		nil,
+	)
+	c.nodeLabelKeys, c.nodeLabels = c.newNodeLabelsDesc(options.NodeLabels)
+	c.serviceCreated = c.newSwarmDesc(
+		"docker_service_created_timestamp_seconds",
+		"The time a service was created, in seconds since the Unix epoch",
+		c.serviceLabelNames(),
+	)
+	c.serviceUpdated = c.newSwarmDesc(
+		"docker_service_updated_timestamp_seconds",
+		"The time a service was last updated, in seconds since the Unix epoch",
+		c.serviceLabelNames(),
+	)
+	c.serviceUpdateState = c.newSwarmDesc(
+		"docker_service_update_state",
+		"The state of the last update of a service, none if it was never updated",
+		c.serviceLabelNames("state"),
+	)
+	c.serviceRestarts = c.newSwarmDesc(
+		"docker_service_restarts_window",
+		"The number of tasks of a service that failed, were rejected or exited by themselves within the crash-loop window",
+		c.serviceLabelNames(),
+	)
+	c.serviceCrashLooping = c.newSwarmDesc(
+		"docker_service_crashlooping",
+		"Whether the tasks of a service restarted at least the crash-loop threshold of times within the crash-loop window",
+		c.serviceLabelNames(),
+	)
+	c.serviceLastTaskError = c.newSwarmDesc(
+		"docker_service_last_task_error",
+		"The error of the most recent failed or rejected task of a service, always 1",
+		c.serviceLabelNames("error"),
+	)
+	c.serviceTaskExits = c.newSwarmDesc(
+		"docker_service_task_exits_total",
+		"The number of tasks of a service whose container exited by itself since the exporter started, by exit code",
+		c.serviceLabelNames("exit_code"),
+	)
+	c.serviceLogMatches = c.newSwarmDesc(
+		"docker_service_log_matches_total",
+		"The number of log lines of a service matching a log pattern since the exporter started",
+		c.serviceLabelNames("pattern"),
+	)
+	c.serviceUpdateProgress = c.newSwarmDesc(
+		"docker_service_update_progress_ratio",
+		"The share of the tasks of a service running its current spec, only exposed while an update or rollback is in progress",
+		c.serviceLabelNames(),
+	)
+	c.serviceUpdateFailed = c.newSwarmDesc(
+		"docker_service_update_failed",
+		"Whether the last update of a service was paused or rolled back",
+		c.serviceLabelNames(),
+	)
+	c.serviceUpdateFailure = c.newSwarmDesc(
+		"docker_service_update_failure_info",
+		"The message of the failed last update of a service, always 1",
+		c.serviceLabelNames("message"),
+	)
+	c.serviceHealthy = c.newSwarmDesc(
+		"docker_service_healthy",
+		"Whether a service runs every desired task, has no failed update and few recent task failures",
+		c.serviceLabelNames(),
+	)
+	c.serviceAvailability = c.newSwarmDesc(
+		"docker_service_availability_ratio",
+		"The fraction of the window during which a service ran at least its desired tasks, as observed by the scrapes",
+		c.serviceLabelNames("window"),
+	)
+	c.serviceLastZeroReplicas = c.newSwarmDesc(
+		"docker_service_last_zero_replicas_timestamp_seconds",
+		"The last time a service was observed running no task while desiring some, or its creation time, in seconds since the Unix epoch",
+		c.serviceLabelNames(),
+	)
+	c.serviceDeployments = c.newSwarmDesc(
+		"docker_service_deployments_total",
+		"The number of updates of a service started since the exporter started",
+		c.serviceLabelNames(),
+	)
+	c.serviceRolloutDuration = c.newSwarmDesc(
+		"docker_service_rollout_duration_seconds",
+		"The duration of the completed updates of a service",
+		c.serviceLabelNames(),
+	)
+	c.containerStartDuration = c.newSwarmDesc(
+		"docker_container_start_duration_seconds",
+		"The time the tasks of a service took from their creation to running, observed for the tasks started since the exporter started",
+		c.serviceLabelNames(),
+	)
+	c.serviceNetworks = c.newSwarmDesc(
+		"docker_service_networks",
+		"The number of networks a service is attached to",
+		c.serviceLabelNames(),
+	)
+	c.serviceNetworkCount = c.newSwarmDesc(
+		"docker_service_network_count",
+		"The number of networks a service is attached to, including the ingress network joined to publish ports",
+		c.serviceLabelNames(),
+	)
+	c.serviceHostNetwork = c.newSwarmDesc(
+		"docker_service_host_network",
+		"Whether a service is attached to the host network, sharing the network namespace of the nodes",
+		c.serviceLabelNames(),
+	)
+	c.serviceNetworkAttachment = c.newSwarmDesc(
+		"docker_service_network_attachment",
+		"Network attachment of a service, always 1",
+		c.serviceLabelNames("network"),
+	)
+	c.nodePublishedPorts = c.newSwarmDesc(
+		"docker_node_published_ports",
+		"The number of host-mode ports published by running tasks on a node",
+		[]string{"node_id", "node_hostname"},
+	)
+	c.nodePublishedPortConflicts = c.newSwarmDesc(
+		"docker_node_published_port_conflicts",
+		"The number of host-mode ports on a node that are also published through the ingress network",
+		[]string{"node_id", "node_hostname"},
+	)
+	c.ingressPortReachable = c.newSwarmDesc(
+		"docker_ingress_port_reachable",
+		"Whether an ingress-published port accepted a TCP connection on the local node",
+		[]string{"port"},
+	)
+	c.networksCount = c.newSwarmDesc(
+		"docker_networks",
+		"The number of swarm-scoped networks by driver",
+		[]string{"driver"},
+	)
+	c.serviceDNSRecords = c.newSwarmDesc(
+		"docker_service_dns_records",
+		"The number of records returned when resolving a service name",
+		c.serviceLabelNames("lookup"),
+	)
+	c.serviceDNSDuration = c.newSwarmDesc(
+		"docker_service_dns_resolution_duration_seconds",
+		"The time taken to resolve a service name",
+		c.serviceLabelNames("lookup"),
+	)
+	c.secretCreated = c.newSwarmDesc(
+		"docker_swarm_secret_created_timestamp_seconds",
+		"The time a secret was created, in seconds since the Unix epoch",
+		[]string{"secret_name"},
+	)
+	c.configCreated = c.newSwarmDesc(
+		"docker_swarm_config_created_timestamp_seconds",
+		"The time a config was created, in seconds since the Unix epoch",
+		[]string{"config_name"},
+	)
+	c.serviceProbeSuccess = c.newSwarmDesc(
+		"docker_service_probe_success",
+		"Whether the published port of a service accepted a connection, or answered an HTTP request with a 2xx status",
+		c.serviceLabelNames("module", "port"),
+	)
+	c.serviceProbeDuration = c.newSwarmDesc(
+		"docker_service_probe_duration_seconds",
+		"The time taken to probe the published port of a service",
+		c.serviceLabelNames("module", "port"),
+	)
+	c.serviceProbeStatusCode = c.newSwarmDesc(
+		"docker_service_probe_http_status_code",
+		"The HTTP status code of the response to the probe of a service",
+		c.serviceLabelNames("module", "port"),
+	)
+	c.serviceLBBackends = c.newSwarmDesc(
+		"docker_service_lb_backends",
+		"The number of running tasks with an address behind a service VIP",
+		c.serviceLabelNames(),
+	)
+	c.serviceRestartPolicy = c.newSwarmDesc(
+		"docker_service_restart_policy",
+		"Restart policy of a service, always 1; max_attempts 0 restarts without limit",
+		c.serviceLabelNames("condition", "max_attempts"),
+	)
+	c.serviceHealthcheckConfigured = c.newSwarmDesc(
+		"docker_service_healthcheck_configured",
+		"Whether the container spec of a service defines a healthcheck",
+		c.serviceLabelNames(),
+	)
+	c.serviceSecrets = c.newSwarmDesc(
+		"docker_service_secrets",
+		"The number of secrets a service uses",
+		c.serviceLabelNames(),
+	)
+	c.serviceConfigs = c.newSwarmDesc(
+		"docker_service_configs",
+		"The number of configs a service uses",
+		c.serviceLabelNames(),
+	)
+	c.serviceSecretReference = c.newSwarmDesc(
+		"docker_service_secret_reference",
+		"Secret used by a service, always 1",
+		c.serviceLabelNames("secret"),
+	)
+	c.serviceConfigReference = c.newSwarmDesc(
+		"docker_service_config_reference",
+		"Config used by a service, always 1",
+		c.serviceLabelNames("config"),
+	)
+	c.servicePublishedPorts = c.newSwarmDesc(
+		"docker_service_published_ports",
+		"The number of ports a service publishes by protocol and publish mode",
+		c.serviceLabelNames("protocol", "publish_mode"),
+	)
+	c.serviceMounts = c.newSwarmDesc(
+		"docker_service_mounts",
+		"The number of mounts of a service by type",
+		c.serviceLabelNames("type"),
+	)
+	c.serviceCapabilityAdded = c.newSwarmDesc(
+		"docker_service_capability_added",
+		"Linux capability added to the containers of a service, always 1",
+		c.serviceLabelNames("capability"),
+	)
+	c.serviceBindMount = c.newSwarmDesc(
+		"docker_service_bind_mount",
+		"Host path bind-mounted into a service, always 1",
+		c.serviceLabelNames("source", "read_only"),
+	)
+	c.taskSlotState = c.newSwarmDesc(
+		"docker_task_slot_state",
+		"State of the latest task of a slot of a replicated service, always 1",
+		c.serviceLabelNames("slot", "state"),
+	)
+	c.serviceUpdateConfig = c.newSwarmDesc(
+		"docker_service_update_config",
+		"Update or rollback configuration of a service, always 1",
+		c.serviceLabelNames("operation", "failure_action", "order"),
+	)
+	c.serviceUpdateParallelism = c.newSwarmDesc(
+		"docker_service_update_parallelism",
+		"The number of tasks an update or rollback of a service replaces at once, 0 replacing all of them",
+		c.serviceLabelNames("operation"),
+	)
+	c.serviceUpdateDelay = c.newSwarmDesc(
+		"docker_service_update_delay_seconds",
+		"The delay between the batches of tasks of an update or rollback of a service",
+		c.serviceLabelNames("operation"),
+	)
+	c.serviceUpdateMonitor = c.newSwarmDesc(
+		"docker_service_update_monitor_seconds",
+		"How long the tasks of a batch of an update or rollback of a service are monitored for failures",
+		c.serviceLabelNames("operation"),
+	)
+	c.serviceUpdateMaxFailureRatio = c.newSwarmDesc(
+		"docker_service_update_max_failure_ratio",
+		"The fraction of tasks that may fail during an update or rollback of a service before the failure action applies",
+		c.serviceLabelNames("operation"),
+	)
+
+	return c
+}
+
+// Describe implements the prometheus.Collector interface
+func (c *DockerSwarmCollector) Describe(ch chan<- *prometheus.Desc) {
+	for _, d := range c.descs {
+		if d.swarm && !c.options.SwarmManager {
+			continue
+		}
+		d.describe(ch)
+	}
+}
+
+// Collect implements the prometheus.Collector interface
+func (c *DockerSwarmCollector) Collect(ch chan<- prometheus.Metric) {
+	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+	defer cancel()
+
+	s := newScrape(ctx, c.docker)
+	c.collect(s)
+	c.expose(ch, s)
+}
+
+// subCollector is a named part of a scrape
+type subCollector struct {
+	name string
+
+	// swarm marks sub-collectors that need the node to be an active swarm member
+	swarm bool
+
+	// sharded marks swarm sub-collectors that split their work across shards,
+	// the others only run on the primary shard
+	sharded bool
+
+	// optional marks opt-in sub-collectors that may be skipped when they are expected to take too long
+	optional bool
+
+	collect func(s *scrape)
+}
+
+// subCollectors returns the enabled sub-collectors in the order they run
+func (c *DockerSwarmCollector) subCollectors() []subCollector {
+	var collectors []subCollector
+	if !c.options.LocalDisabled {
+		collectors = append(collectors,
+			subCollector{name: "containers", collect: c.collectContainerMetrics},
+			subCollector{name: "images", collect: c.collectImageMetrics},
+		)
+		if c.options.ContainerSecurity {
+			collectors = append(collectors, subCollector{name: "container_security", optional: true, collect: c.collectContainerSecurityMetrics})
+		}
+		if c.options.ContainerHealthchecks {
+			collectors = append(collectors, subCollector{name: "container_healthchecks", optional: true, collect: c.collectContainerHealthcheckMetrics})
+		}
+	}
+
+	collectors = append(collectors,
+		subCollector{name: "networks", swarm: true, collect: c.collectNetworkMetrics},
+		subCollector{name: "services", swarm: true, sharded: true, collect: c.collectServiceMetrics},
+	)
+	if c.options.SecretNames != nil || c.options.ConfigNames != nil {
+		collectors = append(collectors, subCollector{name: "secrets", swarm: true, collect: c.collectSecretMetrics})
+	}
+	if c.options.IngressProbe {
+		collectors = append(collectors, subCollector{name: "ingress_probe", swarm: true, sharded: true, optional: true, collect: c.collectIngressProbeMetrics})
+	}
+	if c.options.ServiceProbe {
+		collectors = append(collectors, subCollector{name: "service_probe", swarm: true, sharded: true, optional: true, collect: c.collectServiceProbeMetrics})
+	}
+	if c.options.DNSProbe {
+		collectors = append(collectors, subCollector{name: "dns_probe", swarm: true, sharded: true, optional: true, collect: c.collectDNSProbeMetrics})
+	}
+	if len(c.options.LogPatterns) > 0 {
+		collectors = append(collectors, subCollector{name: "service_logs", swarm: true, sharded: true, optional: true, collect: c.collectServiceLogMetrics})
+	}
+
+	return append(collectors,
+		subCollector{name: "cluster", swarm: true, collect: c.collectClusterMetrics},
+		subCollector{name: "nodes", swarm: true, collect: c.collectNodeMetrics},
+		subCollector{name: "stacks", swarm: true, collect: c.collectStackMetrics},
+		subCollector{name: "node_tasks", swarm: true, collect: c.collectNodeTaskMetrics},
+	)
+}
+
+// collect gathers all metrics of a single scrape
+func (c *DockerSwarmCollector) collect(s *scrape) {
+	// Only managers can list the swarm objects
+	info, err := s.info()
+	manager := err == nil && info.Swarm.ControlAvailable
+	if err == nil {
+		c.nodeInfo.gauge(s.ch, 1, info.Swarm.NodeID, hostnameValue(info.Name, info.Swarm.NodeID))
+
+		var value float64
+		if manager {
+			value = 1
+		}
+		c.swarmManager.gauge(s.ch, value)
+
+		var clusterID string
+		if info.Swarm.Cluster != nil {
+			clusterID = info.Swarm.Cluster.ID
+		}
+		c.swarmInfo.gauge(s.ch, 1, clusterID, info.Swarm.NodeID, labelValue(info.Swarm.NodeAddr),
+			string(info.Swarm.LocalNodeState), strconv.FormatBool(info.Swarm.ControlAvailable))
+		c.collectEngineSecurityMetrics(s, info)
+	}
+
+	s.activeTasksOnly = c.options.ActiveTasksOnly
+
+	// A node promoted after startup has no described swarm families to expose
+	manager = manager && c.options.SwarmManager
+	if manager {
+		s.active = c.haActive(s, info)
+	}
+
+	for _, sc := range c.collectors {
+		if sc.swarm && (!manager || !s.active) {
+			continue
+		}
+		if sc.swarm && !sc.sharded && !c.options.Shard.primary() {
+			continue
+		}
+		if s.truncated() || s.nearDeadline(c.options.DeadlineMargin) {
+			s.skipped = append(s.skipped, sc.name)
+			continue
+		}
+		if c.shouldShed(s, sc) {
+			s.shed = append(s.shed, sc.name)
+			continue
+		}
+		s.run(sc, c.budget(sc.name))
+	}
+}
+
+// budget returns the time a sub-collector may take, zero when it is only bounded by the scrape timeout
+func (c *DockerSwarmCollector) budget(name string) time.Duration {
+	percent, ok := c.options.Budgets[name]
+	if !ok {
+		return 0
+	}
+	return time.Duration(percent / 100 * float64(c.timeout))
+}
+
+// hasSubCollector reports whether a sub-collector of the given name is enabled
+func (c *DockerSwarmCollector) hasSubCollector(name string) bool {
+	for _, sc := range c.subCollectors() {
+		if sc.name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// containerStates lists the states a container can be in, all of which are always exposed
+var containerStates = []string{"created", "running", "paused", "restarting", "removing", "exited", "dead"}
+
+// collectContainerMetrics collects metrics about containers
+func (c *DockerSwarmCollector) collectContainerMetrics(s *scrape) {
+	containers, err := s.docker.ContainerList(s.ctx, container.ListOptions{All: true})
+	if err != nil {
+		if !unavailable(err) {
+			s.apiError("Error listing containers: %v", err)
+		}
+		return
+	}
+
+	var running, stopped, paused int
+	states := make(map[string]int, len(containerStates))
+	for _, state := range containerStates {
+		states[state] = 0
+	}
+
+	for _, container := range containers {
+		if c.options.IgnoredContainers.ignored(container.Labels) {
+			continue
+		}
+
+		// States are compared in lowercase, so that a daemon on another platform capitalizing them is counted alike
+		state := strings.ToLower(container.State)
+		states[state]++
+
+		switch state {
+		case "running":
+			running++
+		case "exited", "created", "dead":
+			stopped++
+		case "paused":
+			paused++
+		}
+	}
+
+	c.containersRunning.gauge(s.ch, float64(running))
+	c.containersStopped.gauge(s.ch, float64(stopped))
+	c.containersPaused.gauge(s.ch, float64(paused))
+
+	for _, state := range sortedKeys(states) {
+		c.containersByState.gauge(s.ch, float64(states[state]), state)
+	}
+}
+
+// collectImageMetrics collects metrics about images
+func (c *DockerSwarmCollector) collectImageMetrics(s *scrape) {
+	// Skip image metrics for now due to API compatibility issues
+	c.imagesCount.gauge(s.ch, 0)
+}
+
+// collectNetworkMetrics collects metrics about networks
+func (c *DockerSwarmCollector) collectNetworkMetrics(s *scrape) {
+	networks, err := s.networks()
+	if err != nil {
+		return
+	}
+
+	// The local networks of the manager answering, such as bridge, host and none, are not part of the swarm
+	driverCounts := make(map[string]int)
+	for _, n := range networks {
+		if n.Scope != "swarm" {
+			continue
+		}
+		driverCounts[labelValue(n.Driver)]++
+	}
+
+	for _, driver := range sortedKeys(driverCounts) {
+		c.networksCount.gauge(s.ch, float64(driverCounts[driver]), driver)
+	}
+}
+
+// collectServiceMetrics collects metrics about services and their tasks
+func (c *DockerSwarmCollector) collectServiceMetrics(s *scrape) {
+	services, err := s.services()
+	if err != nil {
+		return
+	}
+
+	if c.options.Shard.primary() {
+		c.servicesCount.gauge(s.ch, float64(len(services)))
+	}
+
+	// Resolve network IDs to names for the attachment info series
+	networkNames := make(map[string]string)
+	if networks, err := s.networks(); err == nil {
+		for _, n := range networks {
+			networkNames[n.ID] = labelValue(n.Name)
+		}
+	}
+
+	// Collect tasks metrics for each selected service
+	selected := c.selectedServices(services)
+	serviceTasks := s.serviceTasks(selected, len(selected) == len(services))
+	for _, service := range selected {
+		c.serviceCreated.gauge(s.ch, timestampSeconds(service.CreatedAt), c.serviceLabelValues(service)...)
+		c.serviceUpdated.gauge(s.ch, timestampSeconds(service.UpdatedAt), c.serviceLabelValues(service)...)
+
+		updateState := "none"
+		if service.UpdateStatus != nil && service.UpdateStatus.State != "" {
+			updateState = string(service.UpdateStatus.State)
+		}
+		c.serviceUpdateState.gauge(s.ch, 1, c.serviceLabelValues(service, updateState)...)
+
+		var failed float64
+		if updateFailed(service.UpdateStatus) {
+			failed = 1
+			c.serviceUpdateFailure.gauge(s.ch, 1, c.serviceLabelValues(service, messageValue(service.UpdateStatus.Message))...)
+		}
+		c.serviceUpdateFailed.gauge(s.ch, failed, c.serviceLabelValues(service)...)
+
+		deployments := c.deployments.observe(service.ID, s.started, service.UpdateStatus)
+		c.serviceDeployments.counter(s.ch, float64(deployments.total), c.serviceLabelValues(service)...)
+		c.serviceRolloutDuration.histogram(s.ch, deployments.count, deployments.sum, deployments.buckets, c.serviceLabelValues(service)...)
+
+		c.collectServiceNetworkMetrics(s, service, networkNames)
+		c.collectServiceSpecMetrics(s, service)
+
+		// Services whose tasks could not be listed have already failed the scrape
+		tasks, ok := serviceTasks[service.ID]
+		if !ok {
+			continue
+		}
+
+		var runningTasks int
+		for _, task := range tasks {
+			if task.Status.State == swarm.TaskStateRunning {
+				runningTasks++
+			}
+		}
+
+		c.tasksRunning.gauge(s.ch, float64(runningTasks), c.serviceLabelValues(service)...)
+
+		startups := c.startups.observe(service.ID, s.started, tasks)
+		c.containerStartDuration.histogram(s.ch, startups.count, startups.sum, startups.buckets, c.serviceLabelValues(service)...)
+
+		if progress, ok := updateProgress(service, tasks); ok {
+			c.serviceUpdateProgress.gauge(s.ch, progress, c.serviceLabelValues(service)...)
+		}
+
+		c.collectServiceBackendMetrics(s, service, tasks)
+		if c.options.TaskSlots {
+			c.collectTaskSlotMetrics(s, service, tasks)
+		}
+
+		// Get desired replicas
+		var desiredReplicas uint64
+		if service.Spec.Mode.Replicated != nil && service.Spec.Mode.Replicated.Replicas != nil {
+			desiredReplicas = *service.Spec.Mode.Replicated.Replicas
+		} else if service.Spec.Mode.Global != nil {
+			// For global services, desired replicas equals the number of nodes
+			if nodes, err := s.nodes(); err == nil {
+				var activeNodes int
+				for _, node := range nodes {
+					if node.Status.State == swarm.NodeStateReady {
+						activeNodes++
+					}
+				}
+				desiredReplicas = uint64(activeNodes)
+			}
+		}
+
+		c.tasksDesired.gauge(s.ch, float64(desiredReplicas), c.serviceLabelValues(service)...)
+
+		var healthy float64
+		if c.options.Health.healthy(uint64(runningTasks), desiredReplicas, updateState, tasks, s.started) {
+			healthy = 1
+		}
+		c.serviceHealthy.gauge(s.ch, healthy, c.serviceLabelValues(service)...)
+
+		restarts := c.restarts.observe(service, tasks, s.started, c.options.Health.CrashLoopWindow)
+		var crashLooping float64
+		if restarts.restarts >= c.options.Health.CrashLoopRestarts {
+			crashLooping = 1
+		}
+		c.serviceRestarts.gauge(s.ch, float64(restarts.restarts), c.serviceLabelValues(service)...)
+		c.serviceCrashLooping.gauge(s.ch, crashLooping, c.serviceLabelValues(service)...)
+		if task, ok := lastTaskError(tasks); ok {
+			c.serviceLastTaskError.gauge(s.ch, 1, c.serviceLabelValues(service, messageValue(task.Status.Err))...)
+		}
+		for _, code := range sortedKeys(restarts.exits) {
+			c.serviceTaskExits.counter(s.ch, float64(restarts.exits[code]), c.serviceLabelValues(service, strconv.Itoa(code))...)
+		}
+
+		ratios := c.availability.observe(service.ID, s.started, uint64(runningTasks) >= desiredReplicas)
+		for i, window := range availabilityWindows {
+			c.serviceAvailability.gauge(s.ch, ratios[i], c.serviceLabelValues(service, window.name)...)
+		}
+
+		lastZero := c.outages.observe(service.ID, s.started, service.CreatedAt, uint64(runningTasks), desiredReplicas)
+		c.serviceLastZeroReplicas.gauge(s.ch, timestampSeconds(lastZero), c.serviceLabelValues(service)...)
+	}
+
+	c.availability.prune(s.started)
+	c.outages.prune(s.started)
+	c.deployments.prune(s.started)
+	c.startups.prune(s.started)
+	c.restarts.prune(s.started)
+}
+
+// selectedServices returns the services of this shard selected by the stack filter
+func (c *DockerSwarmCollector) selectedServices(services []swarm.Service) []swarm.Service {
+	services = c.options.Stacks.filter(services)
+	if c.options.Shard.count <= 1 {
+		return services
+	}
+
+	selected := make([]swarm.Service, 0, len(services)/c.options.Shard.count+1)
+	for _, service := range services {
+		if c.options.Shard.matches(service) {
+			selected = append(selected, service)
+		}
+	}
+	return selected
+}
+
+// collectNodeMetrics collects metrics about nodes
+func (c *DockerSwarmCollector) collectNodeMetrics(s *scrape) {
+	nodes, err := s.nodes()
+	if err != nil {
+		return
+	}
+
+	var activeNodes, managers, reachableManagers int
+	engineVersions := make(map[string]int)
+	hostnames := make(map[string][]swarm.Node)
+	for _, node := range nodes {
+		hostname := c.options.Labels.nodeHostname(node)
+		hostnames[hostname] = append(hostnames[hostname], node)
+		engineVersions[labelValue(node.Description.Engine.EngineVersion)]++
+		if node.Status.State == swarm.NodeStateReady {
+			activeNodes++
+		}
+		if node.ManagerStatus != nil {
+			managers++
+			if c.options.Nodes.matches(node) {
+				c.managerInfo.gauge(s.ch, 1, node.ID, labelValue(node.ManagerStatus.Addr))
+			}
+			if node.ManagerStatus.Reachability == swarm.ReachabilityReachable {
+				reachableManagers++
+			}
+		}
 	}
-}
 
-// Describe implements the prometheus.Collector interface
-func (c *DockerSwarmCollector) Describe(ch chan<- *prometheus.Desc) {
-	ch <- c.containersRunning
-	ch <- c.containersStopped
-	ch <- c.containersPaused
-	ch <- c.imagesCount
-	ch <- c.servicesCount
-	ch <- c.tasksRunning
-	ch <- c.tasksDesired
-	ch <- c.nodesCount
-	ch <- c.nodesActive
-	ch <- c.stacksCount
-	ch <- c.containersRunningAllNodes
-	ch <- c.totalContainersAllNodes
-}
+	c.nodesCount.gauge(s.ch, float64(len(nodes)))
+	c.nodesActive.gauge(s.ch, float64(activeNodes))
+	c.managersCount.gauge(s.ch, float64(managers))
+	c.managersReachable.gauge(s.ch, float64(reachableManagers))
+	c.leaderChanges.counter(s.ch, float64(c.leaders.observe(nodes)))
 
-// Collect implements the prometheus.Collector interface
-func (c *DockerSwarmCollector) Collect(ch chan<- prometheus.Metric) {
-	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
-	defer cancel()
+	c.engineVersions.gauge(s.ch, float64(len(engineVersions)))
+	for _, version := range sortedKeys(engineVersions) {
+		c.nodesByEngineVersion.gauge(s.ch, float64(engineVersions[version]), version)
+	}
 
-	// Collect container metrics
-	c.collectContainerMetrics(ctx, ch)
+	// Cloned machines keep the hostname of their template, which then refers to several nodes
+	var duplicates int
+	for _, hostname := range sortedKeys(hostnames) {
+		named := hostnames[hostname]
+		if len(named) < 2 {
+			continue
+		}
+		duplicates++
+		for _, node := range named {
+			if c.options.Nodes.matches(node) {
+				c.nodeDuplicateHostname.gauge(s.ch, 1, node.ID, hostname)
+			}
+		}
+	}
+	c.duplicateHostnames.gauge(s.ch, float64(duplicates))
 
-	// Collect image metrics
-	c.collectImageMetrics(ctx, ch)
+	for _, node := range nodes {
+		history := c.nodes.observe(node, s.started)
+		if !c.options.Nodes.matches(node) {
+			continue
+		}
+		hostname := c.options.Labels.nodeHostname(node)
+		c.nodeStatusChanged.gauge(s.ch, timestampSeconds(history.changed), node.ID, hostname)
+		c.nodeDowns.counter(s.ch, float64(history.downs), node.ID, hostname)
+		c.nodeDowntime.counter(s.ch, history.downtime.Seconds(), node.ID, hostname)
+		if !history.drained.IsZero() {
+			c.nodeDrainDuration.gauge(s.ch, s.started.Sub(history.drained).Seconds(), node.ID, hostname)
+		}
+		if len(c.nodeLabelKeys) > 0 {
+			c.collectNodeLabelMetrics(s, node)
+		}
+	}
+	c.nodes.prune(s.started)
+}
 
-	// Check if Docker is in swarm mode
-	info, err := c.dockerClient.Info(ctx)
+// collectStackMetrics collects metrics about stacks
+func (c *DockerSwarmCollector) collectStackMetrics(s *scrape) {
+	services, err := s.services()
 	if err != nil {
-		log.Printf("Error getting Docker info: %v", err)
 		return
 	}
 
-	if info.Swarm.LocalNodeState == "active" {
-		// Collect swarm metrics
-		c.collectSwarmMetrics(ctx, ch)
+	// Docker doesn't have a direct API for stacks, so we need to use labels
+	// Stacks are identified by the "com.docker.stack.namespace" label on services
+	stackMap := make(map[string]bool)
+	for _, service := range services {
+		if stackName, ok := service.Spec.Labels[stackNamespaceLabel]; ok {
+			stackMap[stackName] = true
+		}
 	}
+
+	c.stacksCount.gauge(s.ch, float64(len(stackMap)))
 }
 
-// collectContainerMetrics collects metrics about containers
-func (c *DockerSwarmCollector) collectContainerMetrics(ctx context.Context, ch chan<- prometheus.Metric) {
-	containers, err := c.dockerClient.ContainerList(ctx, container.ListOptions{All: true})
-	if err != nil {
-		log.Printf("Error listing containers: %v", err)
+// collectNodeTaskMetrics collects metrics about the containers running on all nodes
+// In Docker Swarm, we can get this information from tasks
+// Each task corresponds to a container running on a node
+func (c *DockerSwarmCollector) collectNodeTaskMetrics(s *scrape) {
+	nodes, err := s.nodes()
+	if err != nil || len(nodes) == 0 {
 		return
 	}
 
-	var running, stopped, paused int
+	// Create a map to count running containers per node
+	nodeContainers := make(map[string]int)
+	nodeNames := make(map[string]string)
+	nodePorts := make(map[string]int)
+	nodePortConflicts := make(map[string]int)
 
-	for _, container := range containers {
-		switch container.State {
-		case "running":
-			running++
-		case "exited", "created", "dead":
-			stopped++
-		case "paused":
-			paused++
+	// Ports published through the ingress network are bound on every node
+	// A failed service listing has already failed the scrape, so it only leaves the set empty
+	services, _ := s.services()
+	ingressPorts := make(map[string]bool)
+	for _, service := range services {
+		for _, port := range service.Endpoint.Ports {
+			if port.PublishMode == swarm.PortConfigPublishModeIngress && port.PublishedPort != 0 {
+				ingressPorts[publishedPortKey(port)] = true
+			}
 		}
 	}
 
-	ch <- prometheus.MustNewConstMetric(
-		c.containersRunning,
-		prometheus.GaugeValue,
-		float64(running),
-	)
-	ch <- prometheus.MustNewConstMetric(
-		c.containersStopped,
-		prometheus.GaugeValue,
-		float64(stopped),
-	)
-	ch <- prometheus.MustNewConstMetric(
-		c.containersPaused,
-		prometheus.GaugeValue,
-		float64(paused),
-	)
-}
+	selectedNodes := make(map[string]bool)
 
-// collectImageMetrics collects metrics about images
-func (c *DockerSwarmCollector) collectImageMetrics(ctx context.Context, ch chan<- prometheus.Metric) {
-	// Skip image metrics for now due to API compatibility issues
-	ch <- prometheus.MustNewConstMetric(
-		c.imagesCount,
-		prometheus.GaugeValue,
-		0,
-	)
-}
+	// First, get all node IDs and hostnames
+	for _, node := range nodes {
+		nodeID := node.ID
+		nodeContainers[nodeID] = 0
+		nodeNames[nodeID] = c.options.Labels.nodeHostname(node)
+		selectedNodes[nodeID] = c.options.Nodes.matches(node)
+	}
 
-// collectSwarmMetrics collects metrics about Docker Swarm
-func (c *DockerSwarmCollector) collectSwarmMetrics(ctx context.Context, ch chan<- prometheus.Metric) {
-	// Collect services metrics
-	services, err := c.dockerClient.ServiceList(ctx, types.ServiceListOptions{})
+	// Get all tasks (containers) in the swarm
+	tasks, err := s.tasks()
 	if err != nil {
-		log.Printf("Error listing services: %v", err)
-	} else {
-		ch <- prometheus.MustNewConstMetric(
-			c.servicesCount,
-			prometheus.GaugeValue,
-			float64(len(services)),
-		)
-
-		// Collect tasks metrics for each service
-		for _, service := range services {
-			serviceName := service.Spec.Name
-
-			// Get service tasks
-			taskFilters := filters.NewArgs()
-			taskFilters.Add("service", service.ID)
+		return
+	}
 
-			tasks, err := c.dockerClient.TaskList(ctx, types.TaskListOptions{
-				Filters: taskFilters,
-			})
-			if err != nil {
-				log.Printf("Error listing tasks for service %s: %v", serviceName, err)
-				continue
+	// Count running containers per node
+	for _, task := range tasks {
+		if task.Status.State == swarm.TaskStateRunning {
+			nodeID := task.NodeID
+			if _, ok := nodeContainers[nodeID]; ok {
+				nodeContainers[nodeID]++
 			}
 
-			var runningTasks int
-			for _, task := range tasks {
-				if task.Status.State == swarm.TaskStateRunning {
-					runningTasks++
+			// Count host-mode ports bound by this task
+			for _, port := range task.Status.PortStatus.Ports {
+				if port.PublishMode != swarm.PortConfigPublishModeHost {
+					continue
 				}
-			}
-
-			ch <- prometheus.MustNewConstMetric(
-				c.tasksRunning,
-				prometheus.GaugeValue,
-				float64(runningTasks),
-				serviceName,
-			)
-
-			// Get desired replicas
-			var desiredReplicas uint64
-			if service.Spec.Mode.Replicated != nil && service.Spec.Mode.Replicated.Replicas != nil {
-				desiredReplicas = *service.Spec.Mode.Replicated.Replicas
-			} else if service.Spec.Mode.Global != nil {
-				// For global services, desired replicas equals the number of nodes
-				nodes, err := c.dockerClient.NodeList(ctx, types.NodeListOptions{})
-				if err != nil {
-					log.Printf("Error listing nodes: %v", err)
-				} else {
-					var activeNodes int
-					for _, node := range nodes {
-						if node.Status.State == swarm.NodeStateReady {
-							activeNodes++
-						}
-					}
-					desiredReplicas = uint64(activeNodes)
+				nodePorts[nodeID]++
+				if ingressPorts[publishedPortKey(port)] {
+					nodePortConflicts[nodeID]++
 				}
 			}
+		}
+	}
+
+	// Calculate total containers across all nodes
+	totalContainers := 0
+	for _, count := range nodeContainers {
+		totalContainers += count
+	}
 
-			ch <- prometheus.MustNewConstMetric(
-				c.tasksDesired,
-				prometheus.GaugeValue,
-				float64(desiredReplicas),
-				serviceName,
-			)
+	// Expose total containers metric
+	c.totalContainersAllNodes.gauge(s.ch, float64(totalContainers))
+
+	// Expose metrics for each selected node
+	for _, node := range nodes {
+		nodeID := node.ID
+		if !selectedNodes[nodeID] {
+			continue
 		}
+		c.containersRunningAllNodes.gauge(s.ch, float64(nodeContainers[nodeID]), nodeID, nodeNames[nodeID])
+		c.nodePublishedPorts.gauge(s.ch, float64(nodePorts[nodeID]), nodeID, nodeNames[nodeID])
+		c.nodePublishedPortConflicts.gauge(s.ch, float64(nodePortConflicts[nodeID]), nodeID, nodeNames[nodeID])
 	}
+}
 
-	// Collect nodes metrics
-	nodes, err := c.dockerClient.NodeList(ctx, types.NodeListOptions{})
-	if err != nil {
-		log.Printf("Error listing nodes: %v", err)
-	} else {
-		var activeNodes int
-		for _, node := range nodes {
-			if node.Status.State == swarm.NodeStateReady {
-				activeNodes++
+// newNodeLabelsDesc creates the node labels info metric with one label per allowlisted key
+func (c *DockerSwarmCollector) newNodeLabelsDesc(keys []string) ([]string, *metricDesc) {
+	labelNames := []string{"node_id"}
+	seen := make(map[string]bool)
+	var labelKeys []string
+	for _, key := range keys {
+		name := "label_" + sanitizeLabelName(key)
+		if seen[name] {
+			continue
+		}
+		seen[name] = true
+		labelKeys = append(labelKeys, key)
+		labelNames = append(labelNames, name)
+	}
+
+	return labelKeys, c.newSwarmDesc(
+		"docker_node_labels",
+		"Allowlisted node and engine labels of a node, always 1",
+		labelNames,
+	)
+}
+
+// collectNodeLabelMetrics collects the allowlisted labels of a node
+func (c *DockerSwarmCollector) collectNodeLabelMetrics(s *scrape, node swarm.Node) {
+	labelValues := []string{node.ID}
+	for _, key := range c.nodeLabelKeys {
+		// Node spec labels take precedence over engine labels
+		value, ok := node.Spec.Labels[key]
+		if !ok {
+			value = node.Description.Engine.Labels[key]
+		}
+		labelValues = append(labelValues, labelValue(value))
+	}
+
+	c.nodeLabels.gauge(s.ch, 1, labelValues...)
+}
+
+// collectServiceBackendMetrics collects the number of running tasks with an address behind a service VIP
+func (c *DockerSwarmCollector) collectServiceBackendMetrics(s *scrape, service swarm.Service, tasks []swarm.Task) {
+	// DNS round-robin services have no VIP to load-balance behind
+	if service.Endpoint.Spec.Mode == swarm.ResolutionModeDNSRR {
+		return
+	}
+
+	vipNetworks := make(map[string]bool)
+	for _, vip := range service.Endpoint.VirtualIPs {
+		vipNetworks[vip.NetworkID] = true
+	}
+
+	// A task attached to several VIP networks is still a single backend
+	var backends int
+	for _, task := range tasks {
+		if task.Status.State != swarm.TaskStateRunning {
+			continue
+		}
+		for _, attachment := range task.NetworksAttachments {
+			if vipNetworks[attachment.Network.ID] && len(attachment.Addresses) > 0 {
+				backends++
+				break
 			}
 		}
+	}
 
-		ch <- prometheus.MustNewConstMetric(
-			c.nodesCount,
-			prometheus.GaugeValue,
-			float64(len(nodes)),
-		)
-		ch <- prometheus.MustNewConstMetric(
-			c.nodesActive,
-			prometheus.GaugeValue,
-			float64(activeNodes),
-		)
+	c.serviceLBBackends.gauge(s.ch, float64(backends), c.serviceLabelValues(service)...)
+}
+
+// collectTaskSlotMetrics collects the state of the latest task of every slot of a replicated service
+func (c *DockerSwarmCollector) collectTaskSlotMetrics(s *scrape, service swarm.Service, tasks []swarm.Task) {
+	// Global services and jobs have no slots
+	if service.Spec.Mode.Replicated == nil {
+		return
 	}
 
-	// Collect stacks metrics
-	// Docker doesn't have a direct API for stacks, so we need to use labels
-	// Stacks are identified by the "com.docker.stack.namespace" label on services
-	stackMap := make(map[string]bool)
-	for _, service := range services {
-		if stackName, ok := service.Spec.Labels["com.docker.stack.namespace"]; ok {
-			stackMap[stackName] = true
+	// Tasks come ordered by slot, the latest task of a slot replacing the earlier ones
+	var latest []swarm.Task
+	for _, task := range tasks {
+		if task.Slot == 0 {
+			continue
+		}
+		last := len(latest) - 1
+		switch {
+		case last < 0 || latest[last].Slot != task.Slot:
+			latest = append(latest, task)
+		case task.CreatedAt.After(latest[last].CreatedAt):
+			latest[last] = task
 		}
 	}
 
-	ch <- prometheus.MustNewConstMetric(
-		c.stacksCount,
-		prometheus.GaugeValue,
-		float64(len(stackMap)),
-	)
+	for _, task := range latest {
+		c.taskSlotState.gauge(s.ch, 1, c.serviceLabelValues(service, strconv.Itoa(task.Slot), string(task.Status.State))...)
+	}
+}
 
-	// Collect containers running on all nodes
-	// In Docker Swarm, we can get this information from tasks
-	// Each task corresponds to a container running on a node
-	if len(nodes) > 0 {
-		// Create a map to count running containers per node
-		nodeContainers := make(map[string]int)
-		nodeNames := make(map[string]string)
+// sortedKeys returns the keys of a map in order
+func sortedKeys[K cmp.Ordered, V any](m map[K]V) []K {
+	keys := make([]K, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+	return keys
+}
+
+// timestampSeconds converts a time to fractional seconds since the Unix epoch
+func timestampSeconds(t time.Time) float64 {
+	return float64(t.UnixNano()) / 1e9
+}
+
+// publishedPortKey identifies a published port by number and protocol
+func publishedPortKey(port swarm.PortConfig) string {
+	protocol := port.Protocol
+	if protocol == "" {
+		protocol = swarm.PortConfigProtocolTCP
+	}
+	return fmt.Sprintf("%d/%s", port.PublishedPort, protocol)
+}
+
+// collectServiceNetworkMetrics collects metrics about the networks a service is attached to
+func (c *DockerSwarmCollector) collectServiceNetworkMetrics(s *scrape, service swarm.Service, networkNames map[string]string) {
+	attachments := service.Spec.TaskTemplate.Networks
+	if len(attachments) == 0 {
+		// Older clients set networks on the deprecated service-level field
+		attachments = service.Spec.Networks
+	}
+
+	c.serviceNetworks.gauge(s.ch, float64(len(attachments)), c.serviceLabelValues(service)...)
+
+	// Attachments name their network by ID or name, the virtual IPs by ID, so networks are told apart by name
+	joined := make(map[string]bool)
+	for _, attachment := range attachments {
+		joined[cmp.Or(networkNames[attachment.Target], attachment.Target)] = true
+	}
+	for _, vip := range service.Endpoint.VirtualIPs {
+		joined[cmp.Or(networkNames[vip.NetworkID], vip.NetworkID)] = true
+	}
+	c.serviceNetworkCount.gauge(s.ch, float64(len(joined)), c.serviceLabelValues(service)...)
 
-		// First, get all node IDs and hostnames
-		for _, node := range nodes {
-			nodeID := node.ID
-			nodeHostname := node.Description.Hostname
-			nodeContainers[nodeID] = 0
-			nodeNames[nodeID] = nodeHostname
+	var hostNetwork float64
+	for _, attachment := range attachments {
+		if attachment.Target == "host" || networkNames[attachment.Target] == "host" {
+			hostNetwork = 1
 		}
+	}
+	c.serviceHostNetwork.gauge(s.ch, hostNetwork, c.serviceLabelValues(service)...)
 
-		// Get all tasks (containers) in the swarm
-		tasks, err := c.dockerClient.TaskList(ctx, types.TaskListOptions{})
-		if err != nil {
-			log.Printf("Error listing tasks: %v", err)
-		} else {
-			// Count running containers per node
-			for _, task := range tasks {
-				if task.Status.State == swarm.TaskStateRunning {
-					nodeID := task.NodeID
-					if _, ok := nodeContainers[nodeID]; ok {
-						nodeContainers[nodeID]++
-					}
-				}
-			}
+	if !c.options.NetworkAttachments {
+		return
+	}
 
-			// Calculate total containers across all nodes
-			totalContainers := 0
-			for _, count := range nodeContainers {
-				totalContainers += count
-			}
+	for _, attachment := range attachments {
+		networkName := networkNames[attachment.Target]
+		if networkName == "" {
+			networkName = attachment.Target
+		}
 
-			// Expose total containers metric
-			ch <- prometheus.MustNewConstMetric(
-				c.totalContainersAllNodes,
-				prometheus.GaugeValue,
-				float64(totalContainers),
-			)
-
-			// Expose metrics for each node
-			for nodeID, count := range nodeContainers {
-				ch <- prometheus.MustNewConstMetric(
-					c.containersRunningAllNodes,
-					prometheus.GaugeValue,
-					float64(count),
-					nodeID,
-					nodeNames[nodeID],
-				)
-			}
+		c.serviceNetworkAttachment.gauge(s.ch, 1, c.serviceLabelValues(service, networkName)...)
+	}
+}
+
+// clusterHandler serves a handler of the collector selected by the cluster query parameter
+func clusterHandler(collectors map[string]*DockerSwarmCollector, handler func(*DockerSwarmCollector, http.ResponseWriter, *http.Request)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		c, ok := collectors[r.URL.Query().Get("cluster")]
+		if !ok {
+			http.Error(w, "unknown cluster", http.StatusNotFound)
+			return
 		}
+		handler(c, w, r)
+	}
+}
+
+// swarmIdentity returns the ID of the swarm the daemon belongs to and whether it is a manager
+// The daemon is assumed to be a manager when it cannot be asked
+func swarmIdentity(dockerClient *client.Client) (clusterID string, manager bool, err error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	info, err := dockerClient.Info(ctx)
+	if err != nil {
+		return "", true, err
 	}
+	if info.Swarm.Cluster != nil {
+		clusterID = info.Swarm.Cluster.ID
+	}
+	return clusterID, info.Swarm.ControlAvailable, nil
 }
 
 func main() {
+	// dump-state writes the objects of the daemon to a bundle for --replay
+	if len(os.Args) > 1 && os.Args[1] == "dump-state" {
+		flag.CommandLine.Parse(os.Args[2:])
+		if err := dumpState(flag.Arg(0)); err != nil {
+			log.Fatalf("Error dumping Docker state: %v", err)
+		}
+		return
+	}
+
+	// bench measures collections against a generated cluster or the configured daemon
+	if len(os.Args) > 1 && os.Args[1] == "bench" {
+		if err := runBench(os.Args[2:]); err != nil {
+			log.Fatalf("Error running benchmark: %v", err)
+		}
+		return
+	}
+
 	flag.Parse()
 
 	// Show version information if requested
@@ -382,33 +1721,338 @@ func main() {
 		os.Exit(0)
 	}
 
-	// Create Docker client
-	dockerClient, err := client.NewClientWithOpts(
-		client.WithHost(*dockerSocket),
-		client.WithAPIVersionNegotiation(),
-	)
+	if err := applyProfile(*collectProfile); err != nil {
+		log.Fatalf("Error applying collection profile: %v", err)
+	}
+	if *lowResource {
+		if err := applyLowResource(); err != nil {
+			log.Fatalf("Error applying low-resource mode: %v", err)
+		}
+	}
+
+	if *failureMode != failureModeDrop && *failureMode != failureModeStale {
+		log.Fatalf("Invalid failure mode %q, must be %q or %q", *failureMode, failureModeDrop, failureModeStale)
+	}
+
+	stacks, err := newStackFilter(*stacksInclude, *stacksExclude)
+	if err != nil {
+		log.Fatalf("Error parsing stack filter: %v", err)
+	}
+	secretNames, err := compileAnchored(*collectSecretNames)
 	if err != nil {
-		log.Fatalf("Error creating Docker client: %v", err)
+		log.Fatalf("Error parsing secret names: %v", err)
+	}
+	configNames, err := compileAnchored(*collectConfigNames)
+	if err != nil {
+		log.Fatalf("Error parsing config names: %v", err)
 	}
-	defer dockerClient.Close()
 
-	// Test Docker connection
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
+	shard, err := newShardFilter(*shardCount, *shardIndex)
+	if err != nil {
+		log.Fatalf("Error parsing shard flags: %v", err)
+	}
+
+	nodes, err := newNodeFilter(*nodesInclude, *nodesExclude)
+	if err != nil {
+		log.Fatalf("Error parsing node filter: %v", err)
+	}
+
+	ignoredContainers, err := newContainerLabelFilter(*containersIgnoreLabel)
+	if err != nil {
+		log.Fatalf("Error parsing container label filter: %v", err)
+	}
+
+	for _, name := range splitList(*proxyCalls) {
+		if !isDockerCall(name) {
+			log.Fatalf("Unknown Docker API call %q in --docker.socket-proxy.calls", name)
+		}
+	}
+
+	tlsOptions, err := parseTLSSettings(*tlsMinVersion, splitList(*tlsCipherSuites), splitList(*tlsCurves))
+	if err != nil {
+		log.Fatalf("Error parsing TLS settings: %v", err)
+	}
+
+	var cfg fileConfig
+	if *configFile != "" {
+		loaded, err := loadConfig(*configFile)
+		if err != nil {
+			log.Fatalf("Error loading configuration: %v", err)
+		}
+		cfg = *loaded
+	}
+
+	logPatterns, err := parseLogPatterns(cfg.LogPatterns)
+	if err != nil {
+		log.Fatalf("Error loading configuration: %v", err)
+	}
+	relabelRules, err := parseRelabelConfigs(cfg.MetricRelabelConfigs)
+	if err != nil {
+		log.Fatalf("Error loading configuration: %v", err)
+	}
+	derivedMetrics, err := parseDerivedMetrics(cfg.DerivedMetrics)
+	if err != nil {
+		log.Fatalf("Error loading configuration: %v", err)
+	}
+	tenants, err := parseTenants(cfg.Tenants)
+	if err != nil {
+		log.Fatalf("Error loading configuration: %v", err)
+	}
+
+	options := CollectorOptions{
+		Timeout:            *scrapeTimeout,
+		SocketProxy:        *socketProxy,
+		ProxyCalls:         splitList(*proxyCalls),
+		DeadlineMargin:     *scrapeMargin,
+		AdaptiveSkip:       *adaptiveSkip,
+		NetworkAttachments: *collectNetworkAttachments,
+		SecretReferences:   *collectSecretReferences,
+		SecretNames:        secretNames,
+		ConfigNames:        configNames,
+		BindMounts:         *collectBindMounts,
+
+		IngressProbe:        *probeIngress,
+		IngressProbeAddress: *probeIngressAddress,
+		IngressProbeSample:  *probeIngressSample,
+		IngressProbeTimeout: *probeIngressTimeout,
+
+		ServiceProbe:        *probeServices,
+		ServiceProbes:       make(map[string]serviceProbeConfig),
+		ServiceProbeAddress: *probeServicesAddress,
+		ServiceProbeTimeout: *probeServicesTimeout,
+
+		DNSProbe:        *probeDNS,
+		DNSProbeTimeout: *probeDNSTimeout,
+
+		Stacks: stacks,
+		Shard:  shard,
+		Nodes:  nodes,
+
+		IgnoredContainers: ignoredContainers,
+		LocalDisabled:     *localDisabled,
+		ContainerSecurity: *containersSecurity,
+		ActiveTasksOnly:   !*taskHistory,
+		TaskSlots:         *taskSlots,
+		LegacyNames:       *legacyNames,
+		NodeLabels:        splitList(*nodeLabels),
+		FailureMode:       *failureMode,
+		MaxStaleness:      *maxStaleness,
+		HAService:         *haService,
+		ClusterName:       *clusterName,
+		Budgets:           cfg.Budgets,
+		LogPatterns:       logPatterns,
+		LogLines:          *logLines,
+		LogInterval:       *logInterval,
+
+		ContainerHealthchecks: *containersHealth,
+		MetricNames:           cfg.MetricNames,
+
+		Labels: labelRules{
+			TrimStackPrefix: *trimStackPrefix,
+			StackLabel:      *stackLabel,
+			Tenants:         tenants,
+		},
+
+		Health: healthRules{
+			FailureWindow:   *healthFailureWindow,
+			MaxFailures:     *healthMaxFailures,
+			UpdatingHealthy: *healthUpdatingHealthy,
+
+			CrashLoopWindow:   *healthCrashLoopWindow,
+			CrashLoopRestarts: *healthCrashLoopRestarts,
+		},
+	}
+	for _, probe := range cfg.ServiceProbes {
+		options.ServiceProbes[probe.Service] = probe
+	}
+
+	// Create and register the collectors, one per configured cluster or one for the local daemon
+	var collector *DockerSwarmCollector
+	collectors := make(map[string]*DockerSwarmCollector)
+	if len(cfg.Clusters) > 0 {
+		for _, cluster := range cfg.Clusters {
+			dockerClient, err := newDockerClient(cluster.Host, &cluster, tlsOptions)
+			if err != nil {
+				log.Fatalf("Error creating Docker client for cluster %s: %v", cluster.Name, err)
+			}
+			defer dockerClient.Close()
+
+			// An unreachable cluster must not keep the others from being collected
+			clusterOptions := options
+			clusterOptions.ClusterID, clusterOptions.SwarmManager, err = swarmIdentity(dockerClient)
+			if err != nil {
+				log.Printf("Error connecting to cluster %s, its swarm metrics will have no cluster_id label: %v", cluster.Name, err)
+			} else {
+				log.Printf("Connected to cluster %s", cluster.Name)
+			}
+
+			clusterCollector := NewDockerSwarmCollector(dockerClient, clusterOptions)
+			prometheus.WrapRegistererWith(prometheus.Labels{"cluster": cluster.Name}, prometheus.DefaultRegisterer).MustRegister(clusterCollector)
+			collectors[cluster.Name] = clusterCollector
+			if collector == nil {
+				collector = clusterCollector
+			}
+		}
+	} else if *replay != "" || *dockerFixture != "" {
+		var state *dockerState
+		if *replay != "" {
+			state, err = readState(*replay)
+			if err != nil {
+				log.Fatalf("Error reading state bundle: %v", err)
+			}
+			log.Printf("Replaying state bundle %s taken at %s", *replay, state.Created.Format(time.RFC3339))
+		} else {
+			state, err = readFixture(*dockerFixture)
+			if err != nil {
+				log.Fatalf("Error reading Docker fixture: %v", err)
+			}
+			log.Printf("Serving Docker fixture %s", *dockerFixture)
+		}
+
+		options.ClusterID = state.clusterID()
+		options.SwarmManager = state.Info.Swarm.ControlAvailable
+		collector = NewDockerSwarmCollector(staticDocker{state: state}, options)
+		prometheus.MustRegister(collector)
+		collectors[""] = collector
+	} else {
+		dockerClient, err := newDockerClient(*dockerSocket, nil, tlsSettings{})
+		if err != nil {
+			log.Fatalf("Error creating Docker client: %v", err)
+		}
+		defer dockerClient.Close()
+
+		// Test Docker connection
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		_, err = dockerClient.Ping(ctx)
+		if err != nil {
+			log.Fatalf("Error connecting to Docker daemon: %v", err)
+		}
+
+		log.Printf("Connected to Docker daemon")
+
+		// Identify the swarm so several clusters can share one Prometheus
+		options.ClusterID, options.SwarmManager, err = swarmIdentity(dockerClient)
+		if err != nil {
+			log.Printf("Error getting Docker info, swarm metrics will have no cluster_id label: %v", err)
+		} else if !options.SwarmManager {
+			log.Printf("Docker daemon is not a swarm manager, only collecting local metrics")
+		}
+
+		collector = NewDockerSwarmCollector(dockerClient, options)
+		prometheus.MustRegister(collector)
+		collectors[""] = collector
+	}
 
-	_, err = dockerClient.Ping(ctx)
+	for _, c := range collectors {
+		go c.runSelfCheck(context.Background(), *checkInterval)
+	}
+
+	allowedNetworks, err := parseAllowedNetworks(splitList(*allowCIDRs))
 	if err != nil {
-		log.Fatalf("Error connecting to Docker daemon: %v", err)
+		log.Fatalf("Error parsing allowed networks: %v", err)
+	}
+
+	if (*tlsCertFile == "") != (*tlsKeyFile == "") {
+		log.Fatalf("--web.tls-cert-file and --web.tls-key-file must be given together")
 	}
 
-	log.Printf("Connected to Docker daemon")
+	if *rateLimitRate < 0 {
+		log.Fatalf("--web.rate-limit must not be negative")
+	}
+	if *historyRetention > 0 && (*historyResolution <= 0 || *historyRetention < *historyResolution) {
+		log.Fatalf("--history.resolution must be positive and not longer than --history.retention")
+	}
+	var limiter *rateLimiter
+	if *rateLimitRate > 0 {
+		limiter = newRateLimiter(*rateLimitRate, *rateLimitBurst)
+	}
+
+	var bearerToken string
+	if *bearerTokenFile != "" {
+		bearerToken, err = readSecretFile(*bearerTokenFile)
+		if err != nil {
+			log.Fatalf("Error reading bearer token: %v", err)
+		}
+	}
+
+	for name := range cfg.Budgets {
+		if !collector.hasSubCollector(name) {
+			log.Fatalf("Error loading configuration: budget for unknown or disabled sub-collector %q", name)
+		}
+	}
+
+	// Setup HTTP server, the endpoints exposing the state of the swarm are rate limited and require the bearer token
+	protect := func(handler http.Handler) http.Handler {
+		return rateLimit(limiter, bearerAuth(bearerToken, handler))
+	}
+	// Browser pages of the allowed origins may call the JSON API
+	origins := splitList(*corsOrigins)
+	api := func(handler http.Handler) http.Handler {
+		return cors(origins, protect(handler))
+	}
+	// Derived gauges are computed from the collected metrics, the series of the tenants are accounted and limited,
+	// and metric relabel rules and the stripping of HELP texts apply to everything this instance exposes
+	var gatherer prometheus.Gatherer = prometheus.DefaultGatherer
+	if len(derivedMetrics) > 0 {
+		gatherer = derivedGatherer{next: gatherer, metrics: derivedMetrics}
+	}
+	if tenants.enabled() {
+		gatherer = newQuotaGatherer(gatherer, tenants, collector.metricName("docker_exporter_series"), collector.metricName("docker_exporter_series_dropped_total"))
+	}
+	if len(relabelRules) > 0 {
+		gatherer = relabelGatherer{next: gatherer, rules: relabelRules}
+	}
+	if *stripHelp {
+		gatherer = helpStrippingGatherer{next: gatherer}
+	}
+	metricsHandler := promhttp.InstrumentMetricHandler(prometheus.DefaultRegisterer, promhttp.HandlerFor(gatherer, promhttp.HandlerOpts{}))
+	http.Handle(*metricsPath, protect(metricsHandler))
+	if tenants.enabled() {
+		http.Handle(tenantPath, protect(tenantHandler(gatherer, tenants)))
+	}
+	http.Handle("/debug/scrape", protect(clusterHandler(collectors, (*DockerSwarmCollector).serveScrapeTrace)))
+	http.HandleFunc("/alerts.yml", collector.alertsHandler)
+	http.HandleFunc("/dashboard.json", collector.dashboardHandler(len(cfg.Clusters) > 0))
+	http.HandleFunc("/capabilities", clusterHandler(collectors, (*DockerSwarmCollector).capabilitiesHandler))
+	http.Handle("/status", protect(clusterHandler(collectors, (*DockerSwarmCollector).statusHandler)))
+	http.Handle("/api/v1/services", api(clusterHandler(collectors, (*DockerSwarmCollector).servicesAPIHandler)))
+	http.Handle("/api/v1/nodes", api(clusterHandler(collectors, (*DockerSwarmCollector).nodesAPIHandler)))
+	http.Handle("/api/v1/tasks", api(clusterHandler(collectors, (*DockerSwarmCollector).tasksAPIHandler)))
+
+	// The history samples the exposed metrics itself, Prometheus scrapes are not needed
+	if *historyRetention > 0 {
+		metrics := splitList(*historyMetrics)
+		if len(metrics) == 0 {
+			for _, name := range defaultHistoryMetrics {
+				metrics = append(metrics, collector.metricName(name))
+			}
+		}
+		hist := newHistory(gatherer, metrics, *historyResolution, *historyRetention)
+		go hist.run(context.Background())
+		http.Handle("/api/v1/range", api(http.HandlerFunc(hist.rangeAPIHandler)))
+		log.Printf("Keeping %s of history of %d metric families at %s resolution", *historyRetention, len(metrics), *historyResolution)
+	}
 
-	// Create and register collector
-	collector := NewDockerSwarmCollector(dockerClient, *scrapeTimeout)
-	prometheus.MustRegister(collector)
+	if *aggregatorDiscoveryName != "" {
+		agg := newAggregator(collector, *aggregatorDiscoveryName, *aggregatorAgentPort, *aggregatorDiscoveryInterval, *aggregatorDiscoveryTimeout)
+		prometheus.MustRegister(agg)
+		go agg.run(context.Background())
+		log.Printf("Discovering agents through %s every %s", *aggregatorDiscoveryName, *aggregatorDiscoveryInterval)
 
-	// Setup HTTP server
-	http.Handle(*metricsPath, promhttp.Handler())
+		// The agents are expected to share the bearer token and the TLS setup of the aggregator
+		scheme, agentClient := "http", http.DefaultClient
+		if *tlsCertFile != "" {
+			scheme = "https"
+			agentClient, err = newAgentClient(*aggregatorAgentCAFile, *aggregatorAgentServerName, tlsOptions)
+			if err != nil {
+				log.Fatalf("Error creating agent client: %v", err)
+			}
+		}
+		cluster := newClusterGatherer(gatherer, collector, agg, *metricsPath, bearerToken, *scrapeTimeout, scheme, agentClient)
+		http.Handle("/metrics/cluster", protect(promhttp.HandlerFor(cluster, promhttp.HandlerOpts{ErrorHandling: promhttp.ContinueOnError})))
+	}
 	http.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
 		w.Write([]byte(`<html>
 			<head><title>Docker Swarm Exporter</title></head>
@@ -416,14 +2060,38 @@ func main() {
 			<h1>Docker Swarm Exporter</h1>
 			<p>Version: ` + Version + `</p>
 			<p><a href="` + *metricsPath + `">Metrics</a></p>
+			<p><a href="/status">Cluster status</a></p>
+			<p><a href="/debug/scrape">Scrape trace</a></p>
+			<p><a href="/alerts.yml">Alerting rules</a></p>
+			<p><a href="/dashboard.json">Grafana dashboard</a></p>
+			<p><a href="/capabilities">Docker API capabilities</a></p>
 			</body>
 			</html>`))
 	})
 
-	// Start server
+	// Start server, reloading the certificate as it gets rotated
+	server := &http.Server{
+		Addr:    *listenAddress,
+		Handler: allowNetworks(allowedNetworks, http.DefaultServeMux),
+	}
+	scheme := "http"
+	if *tlsCertFile != "" {
+		reloader, err := newCertReloader(*tlsCertFile, *tlsKeyFile)
+		if err != nil {
+			log.Fatalf("Error setting up TLS: %v", err)
+		}
+		go reloader.run(context.Background())
+		server.TLSConfig = &tls.Config{GetCertificate: reloader.getCertificate}
+		tlsOptions.apply(server.TLSConfig)
+		scheme = "https"
+	}
+
 	log.Printf("Starting Docker Swarm exporter on %s", *listenAddress)
-	log.Printf("Metrics available at http://0.0.0.0%s%s", *listenAddress, *metricsPath)
-	if err := http.ListenAndServe(*listenAddress, nil); err != nil {
-		log.Fatalf("Error starting HTTP server: %v", err)
+	log.Printf("Metrics available at %s://0.0.0.0%s%s", scheme, *listenAddress, *metricsPath)
+	if server.TLSConfig != nil {
+		err = server.ListenAndServeTLS("", "")
+	} else {
+		err = server.ListenAndServe()
 	}
+	log.Fatalf("Error starting HTTP server: %v", err)
 }
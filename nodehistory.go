@@ -0,0 +1,104 @@
+package main
+
+import (
+	"sync"
+	"time"
+
+	"github.com/docker/docker/api/types/swarm"
+)
+
+// nodeHistory holds what the exporter observed of a node across scrapes
+type nodeHistory struct {
+	state        swarm.NodeState
+	availability swarm.NodeAvailability
+
+	// changed is the last time the state or availability changed
+	changed time.Time
+	seen    time.Time
+
+	// downs counts the transitions out of ready, downtime adds up the time between scrapes spent not ready
+	downs    uint64
+	downtime time.Duration
+
+	// drained is when the node was drained, zero while it is not
+	drained time.Time
+}
+
+// nodeTracker keeps the history of every node across scrapes
+type nodeTracker struct {
+	mu    sync.Mutex
+	nodes map[string]*nodeHistory
+}
+
+// newNodeTracker creates an empty tracker
+func newNodeTracker() *nodeTracker {
+	return &nodeTracker{nodes: make(map[string]*nodeHistory)}
+}
+
+// clone returns a copy of the tracker sharing no state with it
+func (t *nodeTracker) clone() *nodeTracker {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	c := newNodeTracker()
+	for id, h := range t.nodes {
+		copied := *h
+		c.nodes[id] = &copied
+	}
+	return c
+}
+
+// observe records the state and availability of a node and returns a copy of its history
+// A node seen for the first time takes its last update as last change, which the daemon sets on status changes
+func (t *nodeTracker) observe(node swarm.Node, at time.Time) nodeHistory {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	h, ok := t.nodes[node.ID]
+	if !ok {
+		h = &nodeHistory{
+			state:        node.Status.State,
+			availability: node.Spec.Availability,
+			changed:      node.UpdatedAt,
+		}
+		if h.changed.IsZero() {
+			h.changed = at
+		}
+		if h.availability == swarm.NodeAvailabilityDrain {
+			h.drained = h.changed
+		}
+		t.nodes[node.ID] = h
+	} else if h.state != swarm.NodeStateReady {
+		// The node stayed down at least since the previous scrape
+		h.downtime += at.Sub(h.seen)
+	}
+	h.seen = at
+
+	if h.state == swarm.NodeStateReady && node.Status.State != swarm.NodeStateReady {
+		h.downs++
+	}
+	if node.Spec.Availability != h.availability {
+		if node.Spec.Availability == swarm.NodeAvailabilityDrain {
+			h.drained = at
+		} else {
+			h.drained = time.Time{}
+		}
+	}
+	if node.Status.State != h.state || node.Spec.Availability != h.availability {
+		h.state = node.Status.State
+		h.availability = node.Spec.Availability
+		h.changed = at
+	}
+	return *h
+}
+
+// prune forgets the nodes not observed for a while, e.g. after they were removed
+func (t *nodeTracker) prune(now time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for id, h := range t.nodes {
+		if now.Sub(h.seen) > outageTrackerRetention {
+			delete(t.nodes, id)
+		}
+	}
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"context"
+	"net"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/docker/docker/api/types/swarm"
+)
+
+// ingressProbePorts returns the sorted TCP ports published through the ingress network,
+// limited to the configured sample size
+func ingressProbePorts(services []swarm.Service, sample int) []uint32 {
+	seen := make(map[uint32]bool)
+	var ports []uint32
+	for _, service := range services {
+		for _, port := range service.Endpoint.Ports {
+			if port.PublishMode != swarm.PortConfigPublishModeIngress || port.PublishedPort == 0 {
+				continue
+			}
+			// Only TCP can be checked with a plain connect
+			if port.Protocol != "" && port.Protocol != swarm.PortConfigProtocolTCP {
+				continue
+			}
+			if !seen[port.PublishedPort] {
+				seen[port.PublishedPort] = true
+				ports = append(ports, port.PublishedPort)
+			}
+		}
+	}
+
+	sort.Slice(ports, func(i, j int) bool { return ports[i] < ports[j] })
+	if sample > 0 && len(ports) > sample {
+		ports = ports[:sample]
+	}
+	return ports
+}
+
+// collectIngressProbeMetrics connects to ingress-published ports on the local node
+func (c *DockerSwarmCollector) collectIngressProbeMetrics(s *scrape) {
+	services, err := s.services()
+	if err != nil {
+		return
+	}
+
+	ports := ingressProbePorts(c.selectedServices(services), c.options.IngressProbeSample)
+
+	probeCtx, cancel := context.WithTimeout(s.ctx, c.options.IngressProbeTimeout)
+	defer cancel()
+
+	reachable := make([]bool, len(ports))
+	var wg sync.WaitGroup
+	for i, port := range ports {
+		wg.Add(1)
+		go func(i int, port uint32) {
+			defer wg.Done()
+			var dialer net.Dialer
+			conn, err := dialer.DialContext(probeCtx, "tcp", net.JoinHostPort(c.options.IngressProbeAddress, strconv.FormatUint(uint64(port), 10)))
+			if err != nil {
+				return
+			}
+			conn.Close()
+			reachable[i] = true
+		}(i, port)
+	}
+	wg.Wait()
+
+	for i, port := range ports {
+		var value float64
+		if reachable[i] {
+			value = 1
+		}
+		c.ingressPortReachable.gauge(s.ch, value, strconv.FormatUint(uint64(port), 10))
+	}
+}
+
+// dnsProbeConcurrency limits the number of concurrent DNS lookups per scrape
+const dnsProbeConcurrency = 8
+
+// dnsProbeResult holds the outcome of a single service name lookup
+type dnsProbeResult struct {
+	service  swarm.Service
+	lookup   string
+	records  int
+	duration time.Duration
+}
+
+// collectDNSProbeMetrics resolves the VIP and task records of every service
+func (c *DockerSwarmCollector) collectDNSProbeMetrics(s *scrape) {
+	services, err := s.services()
+	if err != nil {
+		return
+	}
+	services = c.selectedServices(services)
+
+	probeCtx, cancel := context.WithTimeout(s.ctx, c.options.DNSProbeTimeout)
+	defer cancel()
+
+	results := make([]dnsProbeResult, 0, 2*len(services))
+	for _, service := range services {
+		results = append(results,
+			dnsProbeResult{service: service, lookup: "service"},
+			dnsProbeResult{service: service, lookup: "tasks"},
+		)
+	}
+
+	sem := make(chan struct{}, dnsProbeConcurrency)
+	var wg sync.WaitGroup
+	for i := range results {
+		wg.Add(1)
+		go func(result *dnsProbeResult) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			name := result.service.Spec.Name
+			if result.lookup == "tasks" {
+				name = "tasks." + name
+			}
+
+			start := time.Now()
+			addrs, err := net.DefaultResolver.LookupIPAddr(probeCtx, name)
+			result.duration = time.Since(start)
+			if err == nil {
+				result.records = len(addrs)
+			}
+		}(&results[i])
+	}
+	wg.Wait()
+
+	for _, result := range results {
+		c.serviceDNSRecords.gauge(s.ch, float64(result.records), c.serviceLabelValues(result.service, result.lookup)...)
+		c.serviceDNSDuration.gauge(s.ch, result.duration.Seconds(), c.serviceLabelValues(result.service, result.lookup)...)
+	}
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"runtime/debug"
+)
+
+// collectProfiles bundles collector flags under a name, applied to the flags not given on the command line
+// minimal keeps the cluster-wide counts, standard is the defaults, full enables every per-object series
+var collectProfiles = map[string]map[string]string{
+	"minimal": {
+		"collect.stacks.exclude": ".*",
+		"collect.nodes.exclude":  ".*",
+		"collect.tasks.history":  "false",
+	},
+	"standard": {},
+	"full": {
+		"collect.tasks.slots":                 "true",
+		"collect.service.network-attachments": "true",
+		"collect.service.bind-mounts":         "true",
+		"collect.service.secret-references":   "true",
+		"collect.containers.security":         "true",
+		"collect.containers.healthchecks":     "true",
+	},
+}
+
+// lowResourcePresets tunes the collector for the small managers of edge swarms, bounding the memory held between
+// scrapes: no per-task series, fewer log lines kept, and less frequent background fetches
+var lowResourcePresets = map[string]string{
+	"collect.tasks.history":         "false",
+	"collect.tasks.slots":           "false",
+	"collect.service-logs.lines":    "20",
+	"collect.service-logs.interval": "5m",
+	"docker.self-check-interval":    "30m",
+}
+
+// lowResourceMemoryLimit is the soft memory limit of the Go runtime in low-resource mode, unless GOMEMLIMIT sets one
+const lowResourceMemoryLimit = 24 << 20
+
+// applyProfile sets the flags of a profile, flags given on the command line taking precedence
+func applyProfile(name string) error {
+	presets, ok := collectProfiles[name]
+	if !ok {
+		return fmt.Errorf("unknown profile %q, use minimal, standard or full", name)
+	}
+	return applyPresets(presets)
+}
+
+// applyLowResource sets the flags of the low-resource mode not set on the command line or by the profile, and the
+// memory limit of the Go runtime, which then collects garbage more often as the heap nears it
+func applyLowResource() error {
+	if err := applyPresets(lowResourcePresets); err != nil {
+		return err
+	}
+	if os.Getenv("GOMEMLIMIT") == "" {
+		debug.SetMemoryLimit(lowResourceMemoryLimit)
+	}
+	return nil
+}
+
+// applyPresets sets flags to preset values, skipping those already set
+func applyPresets(presets map[string]string) error {
+	given := make(map[string]bool)
+	flag.Visit(func(f *flag.Flag) {
+		given[f.Name] = true
+	})
+	for _, flagName := range sortedKeys(presets) {
+		if given[flagName] {
+			continue
+		}
+		if err := flag.Set(flagName, presets[flagName]); err != nil {
+			return fmt.Errorf("setting --%s: %w", flagName, err)
+		}
+	}
+	return nil
+}
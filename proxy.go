@@ -0,0 +1,306 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"sync"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/network"
+	"github.com/docker/docker/api/types/swarm"
+	"github.com/docker/docker/api/types/system"
+	"github.com/docker/docker/errdefs"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// dockerCall describes a Docker API call made by the collector
+type dockerCall struct {
+	Name     string
+	Endpoint string
+}
+
+// dockerCalls lists every Docker API call the collector makes, with the endpoint it requests
+var dockerCalls = []dockerCall{
+	{Name: "Info", Endpoint: "GET /info"},
+	{Name: "ContainerList", Endpoint: "GET /containers/json"},
+	{Name: "ContainerInspect", Endpoint: "GET /containers/{id}/json"},
+	{Name: "NetworkList", Endpoint: "GET /networks"},
+	{Name: "ServiceList", Endpoint: "GET /services"},
+	{Name: "TaskList", Endpoint: "GET /tasks"},
+	{Name: "NodeList", Endpoint: "GET /nodes"},
+	{Name: "ServiceLogs", Endpoint: "GET /services/{id}/logs"},
+	{Name: "SecretList", Endpoint: "GET /secrets"},
+	{Name: "ConfigList", Endpoint: "GET /configs"},
+}
+
+// isDockerCall reports whether the name is one of the Docker API calls of the collector
+func isDockerCall(name string) bool {
+	for _, call := range dockerCalls {
+		if call.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// errCallUnavailable marks a Docker API call that the socket proxy does not allow
+var errCallUnavailable = errors.New("not allowed by the socket proxy")
+
+// unavailable reports whether a Docker API call failed because the socket proxy does not allow it
+func unavailable(err error) bool {
+	return errors.Is(err, errCallUnavailable)
+}
+
+// capabilities tracks the Docker API calls the socket proxy allows
+type capabilities struct {
+	mu     sync.Mutex
+	denied map[string]bool
+
+	// undeclared are the calls left out of the declared ones, which are never made
+	undeclared map[string]bool
+}
+
+// newCapabilities allows the declared calls, or every call when none is declared
+func newCapabilities(allowed []string) *capabilities {
+	c := &capabilities{denied: make(map[string]bool), undeclared: make(map[string]bool)}
+	if len(allowed) == 0 {
+		return c
+	}
+
+	declared := make(map[string]bool, len(allowed))
+	for _, name := range allowed {
+		declared[name] = true
+	}
+	for _, call := range dockerCalls {
+		c.denied[call.Name] = !declared[call.Name]
+		c.undeclared[call.Name] = !declared[call.Name]
+	}
+	return c
+}
+
+// check returns errCallUnavailable for calls that are not declared or were denied before
+func (c *capabilities) check(name string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.denied[name] {
+		return fmt.Errorf("%s %w", name, errCallUnavailable)
+	}
+	return nil
+}
+
+// result records a call denied by the socket proxy, which is not made again until a self-check finds it allowed
+func (c *capabilities) result(name string, err error) error {
+	if !errdefs.IsForbidden(err) {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.denied[name] {
+		log.Printf("Docker API call %s denied by the socket proxy, no longer making it: %v", name, err)
+		c.denied[name] = true
+	}
+	return fmt.Errorf("%s %w", name, errCallUnavailable)
+}
+
+// allow makes a call denied by the socket proxy again, once its endpoint answered; undeclared calls stay off
+func (c *capabilities) allow(name string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.denied[name] && !c.undeclared[name] {
+		log.Printf("Docker API call %s allowed by the socket proxy again, making it", name)
+		c.denied[name] = false
+	}
+}
+
+// allowed reports whether a call is allowed
+func (c *capabilities) allowed(name string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return !c.denied[name]
+}
+
+// collect sends whether each call is allowed
+func (c *capabilities) collect(ch chan<- prometheus.Metric, d *metricDesc) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, call := range dockerCalls {
+		var value float64
+		if !c.denied[call.Name] {
+			value = 1
+		}
+		d.gauge(ch, value, call.Name)
+	}
+}
+
+// proxyDocker only makes the Docker API calls allowed by the socket proxy
+type proxyDocker struct {
+	api  dockerAPI
+	caps *capabilities
+}
+
+// Info implements the dockerAPI interface
+func (p proxyDocker) Info(ctx context.Context) (system.Info, error) {
+	if err := p.caps.check("Info"); err != nil {
+		return system.Info{}, err
+	}
+	info, err := p.api.Info(ctx)
+	return info, p.caps.result("Info", err)
+}
+
+// ContainerList implements the dockerAPI interface
+func (p proxyDocker) ContainerList(ctx context.Context, options container.ListOptions) ([]container.Summary, error) {
+	if err := p.caps.check("ContainerList"); err != nil {
+		return nil, err
+	}
+	containers, err := p.api.ContainerList(ctx, options)
+	return containers, p.caps.result("ContainerList", err)
+}
+
+// ContainerInspect implements the dockerAPI interface
+func (p proxyDocker) ContainerInspect(ctx context.Context, containerID string) (container.InspectResponse, error) {
+	if err := p.caps.check("ContainerInspect"); err != nil {
+		return container.InspectResponse{}, err
+	}
+	details, err := p.api.ContainerInspect(ctx, containerID)
+	return details, p.caps.result("ContainerInspect", err)
+}
+
+// NetworkList implements the dockerAPI interface
+func (p proxyDocker) NetworkList(ctx context.Context, options network.ListOptions) ([]network.Summary, error) {
+	if err := p.caps.check("NetworkList"); err != nil {
+		return nil, err
+	}
+	networks, err := p.api.NetworkList(ctx, options)
+	return networks, p.caps.result("NetworkList", err)
+}
+
+// ServiceList implements the dockerAPI interface
+func (p proxyDocker) ServiceList(ctx context.Context, options types.ServiceListOptions) ([]swarm.Service, error) {
+	if err := p.caps.check("ServiceList"); err != nil {
+		return nil, err
+	}
+	services, err := p.api.ServiceList(ctx, options)
+	return services, p.caps.result("ServiceList", err)
+}
+
+// TaskList implements the dockerAPI interface
+func (p proxyDocker) TaskList(ctx context.Context, options types.TaskListOptions) ([]swarm.Task, error) {
+	if err := p.caps.check("TaskList"); err != nil {
+		return nil, err
+	}
+	tasks, err := p.api.TaskList(ctx, options)
+	return tasks, p.caps.result("TaskList", err)
+}
+
+// NodeList implements the dockerAPI interface
+func (p proxyDocker) NodeList(ctx context.Context, options types.NodeListOptions) ([]swarm.Node, error) {
+	if err := p.caps.check("NodeList"); err != nil {
+		return nil, err
+	}
+	nodes, err := p.api.NodeList(ctx, options)
+	return nodes, p.caps.result("NodeList", err)
+}
+
+// ServiceLogs implements the dockerAPI interface
+func (p proxyDocker) ServiceLogs(ctx context.Context, serviceID string, options container.LogsOptions) (io.ReadCloser, error) {
+	if err := p.caps.check("ServiceLogs"); err != nil {
+		return nil, err
+	}
+	logs, err := p.api.ServiceLogs(ctx, serviceID, options)
+	return logs, p.caps.result("ServiceLogs", err)
+}
+
+// SecretList implements the dockerAPI interface
+func (p proxyDocker) SecretList(ctx context.Context, options types.SecretListOptions) ([]swarm.Secret, error) {
+	if err := p.caps.check("SecretList"); err != nil {
+		return nil, err
+	}
+	secrets, err := p.api.SecretList(ctx, options)
+	return secrets, p.caps.result("SecretList", err)
+}
+
+// ConfigList implements the dockerAPI interface
+func (p proxyDocker) ConfigList(ctx context.Context, options types.ConfigListOptions) ([]swarm.Config, error) {
+	if err := p.caps.check("ConfigList"); err != nil {
+		return nil, err
+	}
+	configs, err := p.api.ConfigList(ctx, options)
+	return configs, p.caps.result("ConfigList", err)
+}
+
+// capabilityView describes the use of a Docker API call by the exporter
+type capabilityView struct {
+	Call     string   `json:"call"`
+	Endpoint string   `json:"endpoint"`
+	Filters  []string `json:"filters,omitempty"`
+	Used     bool     `json:"used"`
+	Allowed  *bool    `json:"allowed,omitempty"`
+
+	// Checked and Error are the outcome of the latest self-check of the endpoint
+	Checked *bool  `json:"checked,omitempty"`
+	Error   string `json:"error,omitempty"`
+}
+
+// apiCapabilities is the response of the capabilities endpoint
+type apiCapabilities struct {
+	ReadOnly    bool             `json:"read_only"`
+	SocketProxy bool             `json:"socket_proxy"`
+	Calls       []capabilityView `json:"calls"`
+}
+
+// capabilityReport lists the Docker API calls the exporter makes with its options, and the filters it passes
+func (c *DockerSwarmCollector) capabilityReport() apiCapabilities {
+	report := apiCapabilities{
+		ReadOnly:    true,
+		SocketProxy: c.capabilities != nil,
+	}
+	for _, call := range dockerCalls {
+		view := capabilityView{Call: call.Name, Endpoint: call.Endpoint}
+		switch call.Name {
+		case "Info":
+			view.Used = true
+		case "ContainerList":
+			view.Used = !c.options.LocalDisabled
+		case "ContainerInspect":
+			view.Used = !c.options.LocalDisabled && (c.options.ContainerSecurity || c.options.ContainerHealthchecks)
+		case "ServiceLogs":
+			view.Used = c.options.SwarmManager && len(c.options.LogPatterns) > 0
+		case "SecretList":
+			view.Used = c.options.SwarmManager && c.options.SecretNames != nil
+		case "ConfigList":
+			view.Used = c.options.SwarmManager && c.options.ConfigNames != nil
+		case "TaskList":
+			view.Used = c.options.SwarmManager
+			batched := c.options.Stacks.include != nil || c.options.Stacks.exclude != nil || c.options.Shard.count > 1
+			if batched || c.options.HAService != "" {
+				view.Filters = append(view.Filters, "service")
+			}
+			if c.options.ActiveTasksOnly || c.options.HAService != "" {
+				view.Filters = append(view.Filters, "desired-state")
+			}
+		default:
+			view.Used = c.options.SwarmManager
+		}
+		if c.capabilities != nil {
+			allowed := c.capabilities.allowed(call.Name)
+			view.Allowed = &allowed
+		}
+		if result, ok := c.selfCheck.result(call.Name); ok {
+			view.Checked = &result.allowed
+			view.Error = result.err
+		}
+		report.Calls = append(report.Calls, view)
+	}
+	return report
+}
+
+// capabilitiesHandler serves the Docker API calls the exporter makes
+func (c *DockerSwarmCollector) capabilitiesHandler(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, c.capabilityReport())
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// quotaGatherer counts the series of every tenant in the metrics of another gatherer and drops those over its quota,
+// so that the label explosion of one tenant cannot break the monitoring of the others
+type quotaGatherer struct {
+	next  prometheus.Gatherer
+	rules tenantRules
+
+	// seriesName and droppedName are the names of the accounting families
+	seriesName  string
+	droppedName string
+
+	mu      sync.Mutex
+	dropped map[string]uint64
+}
+
+// newQuotaGatherer creates a gatherer accounting the series of the tenants
+func newQuotaGatherer(next prometheus.Gatherer, rules tenantRules, seriesName, droppedName string) *quotaGatherer {
+	return &quotaGatherer{
+		next:        next,
+		rules:       rules,
+		seriesName:  seriesName,
+		droppedName: droppedName,
+		dropped:     make(map[string]uint64),
+	}
+}
+
+// quota returns the maximum number of series of a tenant, 0 for no limit
+func (g *quotaGatherer) quota(tenant string) int {
+	if quota, ok := g.rules.quotas[tenant]; ok {
+		return quota
+	}
+	return g.rules.defaultQuota
+}
+
+// Gather implements the prometheus.Gatherer interface
+// The families are kept in order, so a tenant over its quota loses the series of the families that sort last
+func (g *quotaGatherer) Gather() ([]*dto.MetricFamily, error) {
+	gathered, err := g.next.Gather()
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	series := make(map[string]int)
+	for tenant := range g.rules.quotas {
+		series[tenant] = 0
+	}
+	families := make([]*dto.MetricFamily, 0, len(gathered)+2)
+	for _, family := range gathered {
+		metrics := make([]*dto.Metric, 0, len(family.GetMetric()))
+		for _, metric := range family.GetMetric() {
+			// Services without a tenant are not one team, so they are neither counted nor held to the default quota
+			tenant, ok := metricTenant(metric, g.rules.label)
+			if !ok || tenant == "" {
+				metrics = append(metrics, metric)
+				continue
+			}
+			count := seriesCount(family.GetType(), metric)
+			if quota := g.quota(tenant); quota > 0 && series[tenant]+count > quota {
+				g.dropped[tenant] += uint64(count)
+				continue
+			}
+			series[tenant] += count
+			metrics = append(metrics, metric)
+		}
+		if len(metrics) > 0 {
+			families = append(families, &dto.MetricFamily{Name: family.Name, Help: family.Help, Type: family.Type, Metric: metrics})
+		}
+	}
+
+	seriesFamily := &dto.MetricFamily{
+		Name: &g.seriesName,
+		Help: stringPtr("The number of series exposed for the services of a tenant"),
+		Type: dto.MetricType_GAUGE.Enum(),
+	}
+	for _, tenant := range sortedKeys(series) {
+		value := float64(series[tenant])
+		seriesFamily.Metric = append(seriesFamily.Metric, &dto.Metric{Label: g.tenantLabel(tenant), Gauge: &dto.Gauge{Value: &value}})
+	}
+	droppedFamily := &dto.MetricFamily{
+		Name: &g.droppedName,
+		Help: stringPtr("The number of series of a tenant dropped for exceeding its quota since the exporter started"),
+		Type: dto.MetricType_COUNTER.Enum(),
+	}
+	for _, tenant := range sortedKeys(g.dropped) {
+		value := float64(g.dropped[tenant])
+		droppedFamily.Metric = append(droppedFamily.Metric, &dto.Metric{Label: g.tenantLabel(tenant), Counter: &dto.Counter{Value: &value}})
+	}
+	for _, family := range []*dto.MetricFamily{seriesFamily, droppedFamily} {
+		if len(family.Metric) > 0 {
+			families = append(families, family)
+		}
+	}
+
+	accounted, accountErr := prometheus.Gatherers{prometheus.GathererFunc(func() ([]*dto.MetricFamily, error) {
+		return families, nil
+	})}.Gather()
+	if err == nil {
+		err = accountErr
+	}
+	return accounted, err
+}
+
+// metricTenant returns the tenant label value of a metric, if it belongs to a service
+func metricTenant(metric *dto.Metric, label string) (string, bool) {
+	for _, pair := range metric.GetLabel() {
+		if pair.GetName() == label {
+			return pair.GetValue(), true
+		}
+	}
+	return "", false
+}
+
+// seriesCount returns the number of series a metric is exposed as
+func seriesCount(kind dto.MetricType, metric *dto.Metric) int {
+	switch kind {
+	case dto.MetricType_HISTOGRAM:
+		// The buckets, including +Inf, the sum and the count
+		return len(metric.GetHistogram().GetBucket()) + 3
+	case dto.MetricType_SUMMARY:
+		return len(metric.GetSummary().GetQuantile()) + 2
+	}
+	return 1
+}
+
+// tenantLabel returns the tenant label pair of the accounting families
+func (g *quotaGatherer) tenantLabel(tenant string) []*dto.LabelPair {
+	return []*dto.LabelPair{{Name: &g.rules.label, Value: &tenant}}
+}
+
+// stringPtr returns a pointer to a string, as the protobuf messages hold them
+func stringPtr(s string) *string {
+	return &s
+}
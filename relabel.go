@@ -0,0 +1,188 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// Relabeling actions, named as in the metric_relabel_configs of Prometheus
+const (
+	relabelKeep    = "keep"
+	relabelDrop    = "drop"
+	relabelReplace = "replace"
+)
+
+// relabelConfig is a rule of the metric_relabel_configs section of the configuration file
+type relabelConfig struct {
+	SourceLabels []string `yaml:"source_labels"`
+	Separator    *string  `yaml:"separator"`
+	Regex        *string  `yaml:"regex"`
+	TargetLabel  string   `yaml:"target_label"`
+	Replacement  *string  `yaml:"replacement"`
+	Action       string   `yaml:"action"`
+}
+
+// relabelRule is a compiled relabel config
+type relabelRule struct {
+	sourceLabels []string
+	separator    string
+	regex        *regexp.Regexp
+	targetLabel  string
+	replacement  string
+	action       string
+}
+
+// parseRelabelConfigs compiles relabel configs, filling in the defaults of Prometheus
+func parseRelabelConfigs(configs []relabelConfig) ([]relabelRule, error) {
+	var rules []relabelRule
+	for i, config := range configs {
+		rule := relabelRule{
+			sourceLabels: config.SourceLabels,
+			separator:    ";",
+			targetLabel:  config.TargetLabel,
+			replacement:  "$1",
+			action:       config.Action,
+		}
+		if config.Separator != nil {
+			rule.separator = *config.Separator
+		}
+		if config.Replacement != nil {
+			rule.replacement = *config.Replacement
+		}
+		if rule.action == "" {
+			rule.action = relabelReplace
+		}
+
+		expr := "(.*)"
+		if config.Regex != nil {
+			expr = *config.Regex
+		}
+		var err error
+		if rule.regex, err = regexp.Compile("^(?:" + expr + ")$"); err != nil {
+			return nil, fmt.Errorf("metric relabel config %d: invalid regex: %w", i, err)
+		}
+
+		switch rule.action {
+		case relabelKeep, relabelDrop:
+		case relabelReplace:
+			if rule.targetLabel == "" {
+				return nil, fmt.Errorf("metric relabel config %d: replace needs a target_label", i)
+			}
+		default:
+			return nil, fmt.Errorf("metric relabel config %d: unknown action %q, use keep, drop or replace", i, rule.action)
+		}
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
+
+// apply relabels the labels of a metric, __name__ holding its name, and reports whether the metric is kept
+// A replacement resulting in an empty value removes the target label, as in Prometheus
+func (r relabelRule) apply(labels map[string]string) bool {
+	values := make([]string, len(r.sourceLabels))
+	for i, name := range r.sourceLabels {
+		values[i] = labels[name]
+	}
+	value := strings.Join(values, r.separator)
+
+	switch r.action {
+	case relabelKeep:
+		return r.regex.MatchString(value)
+	case relabelDrop:
+		return !r.regex.MatchString(value)
+	}
+
+	match := r.regex.FindStringSubmatchIndex(value)
+	if match == nil {
+		return true
+	}
+	result := string(r.regex.ExpandString(nil, r.replacement, value, match))
+	if result == "" {
+		delete(labels, r.targetLabel)
+	} else {
+		labels[r.targetLabel] = result
+	}
+	return true
+}
+
+// relabelGatherer applies the metric relabel rules to the metrics of another gatherer before they are exposed
+type relabelGatherer struct {
+	next  prometheus.Gatherer
+	rules []relabelRule
+}
+
+// Gather implements the prometheus.Gatherer interface
+// Metrics renamed into another family join it, and the families are checked for consistency again
+func (g relabelGatherer) Gather() ([]*dto.MetricFamily, error) {
+	gathered, err := g.next.Gather()
+
+	var families []*dto.MetricFamily
+	for _, family := range gathered {
+		renamed := make(map[string]*dto.MetricFamily)
+		var names []string
+		for _, metric := range family.GetMetric() {
+			labels := map[string]string{"__name__": family.GetName()}
+			for _, pair := range metric.GetLabel() {
+				labels[pair.GetName()] = pair.GetValue()
+			}
+			if !g.relabel(labels) {
+				continue
+			}
+
+			name := labels["__name__"]
+			delete(labels, "__name__")
+			if name == "" {
+				continue
+			}
+			target, ok := renamed[name]
+			if !ok {
+				target = &dto.MetricFamily{Name: &name, Help: family.Help, Type: family.Type}
+				renamed[name] = target
+				names = append(names, name)
+			}
+			target.Metric = append(target.Metric, relabeledMetric(metric, labels))
+		}
+		for _, name := range names {
+			families = append(families, renamed[name])
+		}
+	}
+
+	relabeled, relabelErr := prometheus.Gatherers{prometheus.GathererFunc(func() ([]*dto.MetricFamily, error) {
+		return families, nil
+	})}.Gather()
+	if err == nil {
+		err = relabelErr
+	}
+	return relabeled, err
+}
+
+// relabel applies the rules in order, stopping at the first one that drops the metric
+func (g relabelGatherer) relabel(labels map[string]string) bool {
+	for _, rule := range g.rules {
+		if !rule.apply(labels) {
+			return false
+		}
+	}
+	return true
+}
+
+// relabeledMetric returns a metric sharing the value of another with other labels, sorted by name
+func relabeledMetric(metric *dto.Metric, labels map[string]string) *dto.Metric {
+	relabeled := &dto.Metric{
+		Gauge:       metric.Gauge,
+		Counter:     metric.Counter,
+		Summary:     metric.Summary,
+		Untyped:     metric.Untyped,
+		Histogram:   metric.Histogram,
+		TimestampMs: metric.TimestampMs,
+	}
+	for _, name := range sortedKeys(labels) {
+		value := labels[name]
+		relabeled.Label = append(relabeled.Label, &dto.LabelPair{Name: &name, Value: &value})
+	}
+	return relabeled
+}
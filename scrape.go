@@ -0,0 +1,407 @@
+package main
+
+import (
+	"context"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/api/types/network"
+	"github.com/docker/docker/api/types/swarm"
+	"github.com/docker/docker/api/types/system"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Failure modes selecting what is exposed when a Docker API call fails
+const (
+	failureModeDrop  = "drop"
+	failureModeStale = "stale"
+)
+
+// scrape holds the state of a single collection
+type scrape struct {
+	ctx    context.Context
+	ch     chan prometheus.Metric
+	docker dockerAPI
+
+	metrics []prometheus.Metric
+	done    chan struct{}
+	errors  int
+
+	// active is false when another exporter replica exposes the swarm metrics
+	active bool
+
+	// skipped lists the sub-collectors not run because the deadline was near
+	skipped []string
+
+	// shed lists the optional sub-collectors not run because they usually take longer than the time that was left
+	shed []string
+
+	// warnings lists the API objects that missed a field the collector relies on
+	warnings []parseWarning
+
+	// activeTasksOnly leaves the tasks no longer desired to be running out of the task listings
+	activeTasksOnly bool
+
+	// Docker API objects shared between sub-collectors, fetched on first use
+	infoResult     fetched[system.Info]
+	servicesResult fetched[[]swarm.Service]
+	nodesResult    fetched[[]swarm.Node]
+	tasksResult    fetched[[]swarm.Task]
+	networksResult fetched[[]network.Summary]
+
+	// trace of the Docker API calls and sub-collectors
+	started    time.Time
+	collector  string
+	calls      []apiCall
+	collectors []collectorRun
+}
+
+// fetched caches the result of a Docker API call
+type fetched[T any] struct {
+	done  bool
+	value T
+	err   error
+}
+
+// apiCall describes a Docker API call made during a scrape
+type apiCall struct {
+	Collector       string              `json:"collector"`
+	Call            string              `json:"call"`
+	Filters         map[string][]string `json:"filters,omitempty"`
+	DurationSeconds float64             `json:"duration_seconds"`
+	Items           int                 `json:"items"`
+	Error           string              `json:"error,omitempty"`
+}
+
+// collectorRun describes a sub-collector run during a scrape
+type collectorRun struct {
+	Name            string  `json:"name"`
+	DurationSeconds float64 `json:"duration_seconds"`
+	Calls           int     `json:"calls"`
+	CallSeconds     float64 `json:"call_seconds"`
+}
+
+// newScrape starts a collection that buffers every metric sent on its channel
+func newScrape(ctx context.Context, docker dockerAPI) *scrape {
+	s := &scrape{
+		ctx:     ctx,
+		ch:      make(chan prometheus.Metric),
+		done:    make(chan struct{}),
+		started: time.Now(),
+		active:  true,
+	}
+	s.docker = tracingDocker{api: docker, s: s}
+	go func() {
+		defer close(s.done)
+		for m := range s.ch {
+			s.metrics = append(s.metrics, m)
+		}
+	}()
+	return s
+}
+
+// apiError logs a failed Docker API call and marks the scrape as failed
+func (s *scrape) apiError(format string, args ...interface{}) {
+	log.Printf(format, args...)
+	s.errors++
+}
+
+// finish ends the collection and returns the buffered metrics
+func (s *scrape) finish() []prometheus.Metric {
+	close(s.ch)
+	<-s.done
+	return s.metrics
+}
+
+// failed reports whether any Docker API call of the scrape failed
+func (s *scrape) failed() bool {
+	return s.errors > 0
+}
+
+// nearDeadline reports whether less than the margin is left before the deadline of the scrape
+func (s *scrape) nearDeadline(margin time.Duration) bool {
+	deadline, ok := s.ctx.Deadline()
+	return ok && time.Until(deadline) < margin
+}
+
+// timeLeft returns the time left before the deadline of the scrape, if it has one
+func (s *scrape) timeLeft() (time.Duration, bool) {
+	deadline, ok := s.ctx.Deadline()
+	return time.Until(deadline), ok
+}
+
+// truncated reports whether sub-collectors were skipped to meet the deadline
+func (s *scrape) truncated() bool {
+	return len(s.skipped) > 0
+}
+
+// run runs a sub-collector and records its duration
+// A non-zero budget bounds the time its Docker API calls may take
+func (s *scrape) run(sc subCollector, budget time.Duration) {
+	s.collector = sc.name
+	firstCall := len(s.calls)
+	start := time.Now()
+
+	if budget > 0 {
+		parent := s.ctx
+		ctx, cancel := context.WithTimeout(parent, budget)
+		s.ctx = ctx
+		defer func() {
+			cancel()
+			s.ctx = parent
+		}()
+	}
+
+	sc.collect(s)
+
+	run := collectorRun{
+		Name:            sc.name,
+		DurationSeconds: time.Since(start).Seconds(),
+	}
+	for _, call := range s.calls[firstCall:] {
+		run.Calls++
+		run.CallSeconds += call.DurationSeconds
+	}
+	s.collectors = append(s.collectors, run)
+	s.collector = ""
+}
+
+// recordCall adds a Docker API call to the trace of the scrape
+func (s *scrape) recordCall(call string, args filters.Args, start time.Time, items int, err error) {
+	record := apiCall{
+		Collector:       s.collector,
+		Call:            call,
+		DurationSeconds: time.Since(start).Seconds(),
+		Items:           items,
+	}
+	if args.Len() > 0 {
+		record.Filters = make(map[string][]string)
+		for _, key := range args.Keys() {
+			record.Filters[key] = args.Get(key)
+		}
+	}
+	if err != nil {
+		record.Error = err.Error()
+		record.Items = 0
+	}
+	s.calls = append(s.calls, record)
+}
+
+// fetch returns the cached result of a Docker API call, making the call on first use
+func fetch[T any](s *scrape, result *fetched[T], what string, call func() (T, error)) (T, error) {
+	if !result.done {
+		result.value, result.err = call()
+		result.done = true
+		if result.err != nil && !unavailable(result.err) {
+			s.apiError("Error %s: %v", what, result.err)
+		}
+	}
+	return result.value, result.err
+}
+
+// info returns the Docker daemon information
+func (s *scrape) info() (system.Info, error) {
+	return fetch(s, &s.infoResult, "getting Docker info", func() (system.Info, error) {
+		return s.docker.Info(s.ctx)
+	})
+}
+
+// services returns all services of the swarm
+func (s *scrape) services() ([]swarm.Service, error) {
+	return fetch(s, &s.servicesResult, "listing services", func() ([]swarm.Service, error) {
+		services, err := s.docker.ServiceList(s.ctx, types.ServiceListOptions{})
+		sortServices(services)
+		s.normalizeServices(services)
+		return services, err
+	})
+}
+
+// nodes returns all nodes of the swarm
+func (s *scrape) nodes() ([]swarm.Node, error) {
+	return fetch(s, &s.nodesResult, "listing nodes", func() ([]swarm.Node, error) {
+		nodes, err := s.docker.NodeList(s.ctx, types.NodeListOptions{})
+		sortNodes(nodes)
+		s.normalizeNodes(nodes)
+		return nodes, err
+	})
+}
+
+// tasks returns all tasks of the swarm
+func (s *scrape) tasks() ([]swarm.Task, error) {
+	return fetch(s, &s.tasksResult, "listing tasks", func() ([]swarm.Task, error) {
+		tasks, err := s.docker.TaskList(s.ctx, s.taskListOptions())
+		sortTasks(tasks)
+		s.normalizeTasks(tasks)
+		return tasks, err
+	})
+}
+
+// sortServices orders services by name, so that metrics come out in the same order on every scrape
+func sortServices(services []swarm.Service) {
+	sort.Slice(services, func(i, j int) bool {
+		if services[i].Spec.Name != services[j].Spec.Name {
+			return services[i].Spec.Name < services[j].Spec.Name
+		}
+		return services[i].ID < services[j].ID
+	})
+}
+
+// sortNodes orders nodes by hostname and ID
+func sortNodes(nodes []swarm.Node) {
+	sort.Slice(nodes, func(i, j int) bool {
+		if nodes[i].Description.Hostname != nodes[j].Description.Hostname {
+			return nodes[i].Description.Hostname < nodes[j].Description.Hostname
+		}
+		return nodes[i].ID < nodes[j].ID
+	})
+}
+
+// sortTasks orders tasks by service, slot and ID
+func sortTasks(tasks []swarm.Task) {
+	sort.Slice(tasks, func(i, j int) bool {
+		if tasks[i].ServiceID != tasks[j].ServiceID {
+			return tasks[i].ServiceID < tasks[j].ServiceID
+		}
+		if tasks[i].Slot != tasks[j].Slot {
+			return tasks[i].Slot < tasks[j].Slot
+		}
+		return tasks[i].ID < tasks[j].ID
+	})
+}
+
+// taskBatchSize is the number of services whose tasks are listed by a single call
+const taskBatchSize = 50
+
+// taskListOptions returns the options listing the tasks of the given services, or of all services when none is given
+func (s *scrape) taskListOptions(serviceIDs ...string) types.TaskListOptions {
+	args := filters.NewArgs()
+	if s.activeTasksOnly {
+		args.Add("desired-state", string(swarm.TaskStateRunning))
+	}
+	for _, id := range serviceIDs {
+		args.Add("service", id)
+	}
+	return types.TaskListOptions{Filters: args}
+}
+
+// serviceTasks returns the tasks of the given services by service ID
+// The tasks of all services come from the shared task list, a subset is listed in batches of services
+// Services whose tasks could not be listed are missing from the result
+func (s *scrape) serviceTasks(services []swarm.Service, all bool) map[string][]swarm.Task {
+	byService := make(map[string][]swarm.Task, len(services))
+	if all {
+		tasks, err := s.tasks()
+		if err != nil {
+			return byService
+		}
+		for _, service := range services {
+			byService[service.ID] = nil
+		}
+		for _, task := range tasks {
+			if _, ok := byService[task.ServiceID]; ok {
+				byService[task.ServiceID] = append(byService[task.ServiceID], task)
+			}
+		}
+		return byService
+	}
+
+	for start := 0; start < len(services); start += taskBatchSize {
+		batch := services[start:min(start+taskBatchSize, len(services))]
+		ids := make([]string, 0, len(batch))
+		for _, service := range batch {
+			ids = append(ids, service.ID)
+		}
+
+		tasks, err := s.docker.TaskList(s.ctx, s.taskListOptions(ids...))
+		if err != nil {
+			if !unavailable(err) {
+				s.apiError("Error listing tasks for %d services: %v", len(batch), err)
+			}
+			continue
+		}
+		for _, id := range ids {
+			byService[id] = nil
+		}
+		sortTasks(tasks)
+		s.normalizeTasks(tasks)
+		for _, task := range tasks {
+			byService[task.ServiceID] = append(byService[task.ServiceID], task)
+		}
+	}
+	return byService
+}
+
+// networks returns all networks known to the daemon
+func (s *scrape) networks() ([]network.Summary, error) {
+	return fetch(s, &s.networksResult, "listing networks", func() ([]network.Summary, error) {
+		return s.docker.NetworkList(s.ctx, network.ListOptions{})
+	})
+}
+
+// scrapeCache keeps the metrics of the last successful scrape
+type scrapeCache struct {
+	mu          sync.Mutex
+	metrics     []prometheus.Metric
+	lastSuccess time.Time
+
+	// snapshot holds the swarm objects of the last successful scrape
+	snapshot *snapshot
+}
+
+// expired reports whether the cached metrics are older than the maximum staleness, zero meaning no maximum
+func (c *scrapeCache) expired(maxStaleness time.Duration) bool {
+	return maxStaleness > 0 && time.Since(c.lastSuccess) > maxStaleness
+}
+
+// expose finishes a scrape and sends its metrics, or handles its failure according to the failure mode
+func (c *DockerSwarmCollector) expose(ch chan<- prometheus.Metric, s *scrape) {
+	metrics := s.finish()
+
+	c.cache.mu.Lock()
+	defer c.cache.mu.Unlock()
+
+	var up, stale, active, truncated float64
+	if s.active {
+		active = 1
+	}
+	switch {
+	case !s.failed() && s.truncated():
+		// Expose the partial metrics but keep caching the last complete scrape
+		up = 1
+		truncated = 1
+	case !s.failed():
+		up = 1
+		c.cache.metrics = metrics
+		c.cache.lastSuccess = time.Now()
+		c.cache.snapshot = s.snapshot()
+	case c.options.FailureMode == failureModeStale && c.cache.metrics != nil && !c.cache.expired(c.options.MaxStaleness):
+		metrics = c.cache.metrics
+		stale = 1
+	default:
+		metrics = nil
+	}
+
+	for _, m := range metrics {
+		ch <- m
+	}
+
+	c.up.gauge(ch, up)
+	c.dataStale.gauge(ch, stale)
+	c.isActive.gauge(ch, active)
+	c.scrapeTruncated.gauge(ch, truncated)
+	c.durations.observe(s)
+	c.durations.collect(ch, c.collectorSkipped, c.collectors)
+	if c.capabilities != nil {
+		c.capabilities.collect(ch, c.callAllowed)
+	}
+	c.selfCheck.collect(ch, c.endpointAllowed, c.endpointFailure)
+	c.parseWarnings.add(s.warnings)
+	c.parseWarnings.collect(ch, c.parseWarningsTotal)
+	if !c.cache.lastSuccess.IsZero() {
+		c.lastSuccess.gauge(ch, timestampSeconds(c.cache.lastSuccess))
+	}
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"github.com/docker/docker/api/types"
+)
+
+// collectSecretMetrics exposes when the secrets and configs whose names are allowlisted were created, never reading
+// their data. Both are immutable, rotating one means creating a new one
+func (c *DockerSwarmCollector) collectSecretMetrics(s *scrape) {
+	if c.options.SecretNames != nil {
+		secrets, err := s.docker.SecretList(s.ctx, types.SecretListOptions{})
+		switch {
+		case err == nil:
+			for _, secret := range secrets {
+				if c.options.SecretNames.MatchString(secret.Spec.Name) {
+					c.secretCreated.gauge(s.ch, timestampSeconds(secret.CreatedAt), labelValue(secret.Spec.Name))
+				}
+			}
+		case !unavailable(err):
+			s.apiError("Error listing secrets: %v", err)
+		}
+	}
+
+	if c.options.ConfigNames != nil {
+		configs, err := s.docker.ConfigList(s.ctx, types.ConfigListOptions{})
+		switch {
+		case err == nil:
+			for _, config := range configs {
+				if c.options.ConfigNames.MatchString(config.Spec.Name) {
+					c.configCreated.gauge(s.ch, timestampSeconds(config.CreatedAt), labelValue(config.Spec.Name))
+				}
+			}
+		case !unavailable(err):
+			s.apiError("Error listing configs: %v", err)
+		}
+	}
+}
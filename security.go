@@ -0,0 +1,137 @@
+package main
+
+import (
+	"slices"
+	"strings"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/system"
+	"github.com/docker/docker/errdefs"
+)
+
+// hostNamespaces lists the namespaces a container can share with its host, all of which are always exposed
+var hostNamespaces = []string{"ipc", "network", "pid"}
+
+// engineSecurityOptions lists the security options of the daemon that are always exposed, others only when enabled
+var engineSecurityOptions = []string{"apparmor", "cgroupns", "rootless", "seccomp", "selinux", "userns"}
+
+// unconfinedProfiles lists the confinements a container can opt out of, all of which are always exposed
+var unconfinedProfiles = []string{"apparmor", "seccomp", "userns"}
+
+// collectEngineSecurityMetrics collects the security options and the isolation the local daemon runs with
+func (c *DockerSwarmCollector) collectEngineSecurityMetrics(s *scrape, info system.Info) {
+	enabled := make(map[string]bool, len(engineSecurityOptions))
+	for _, option := range engineSecurityOptions {
+		enabled[option] = false
+	}
+	for _, option := range info.SecurityOptions {
+		// Options read like name=seccomp,profile=builtin, a daemon started with an unconfined default profile has none
+		name, settings, _ := strings.Cut(option, ",")
+		enabled[labelValue(strings.TrimPrefix(name, "name="))] = !slices.Contains(strings.Split(settings, ","), "profile=unconfined")
+	}
+
+	for _, option := range sortedKeys(enabled) {
+		var value float64
+		if enabled[option] {
+			value = 1
+		}
+		c.engineSecurityOption.gauge(s.ch, value, option)
+	}
+
+	// Linux daemons leave the isolation out, Windows ones run process or hyperv isolated containers by default
+	isolation := string(info.Isolation)
+	if isolation == "" {
+		isolation = string(container.IsolationDefault)
+	}
+	c.engineIsolation.gauge(s.ch, 1, labelValue(info.OSType), labelValue(isolation))
+}
+
+// collectContainerSecurityMetrics collects the running containers of the local daemon with elevated privileges
+// The privileges are only part of the inspected container, so every running container is inspected
+func (c *DockerSwarmCollector) collectContainerSecurityMetrics(s *scrape) {
+	containers, err := s.docker.ContainerList(s.ctx, container.ListOptions{})
+	if err != nil {
+		if !unavailable(err) {
+			s.apiError("Error listing running containers: %v", err)
+		}
+		return
+	}
+
+	var privileged, capabilitiesAdded int
+	shared := make(map[string]int, len(hostNamespaces))
+	for _, namespace := range hostNamespaces {
+		shared[namespace] = 0
+	}
+	unconfined := make(map[string]int, len(unconfinedProfiles))
+
+	for _, summary := range containers {
+		if c.options.IgnoredContainers.ignored(summary.Labels) {
+			continue
+		}
+
+		details, err := s.docker.ContainerInspect(s.ctx, summary.ID)
+		if errdefs.IsNotFound(err) {
+			// The container was removed since it was listed
+			continue
+		}
+		if err != nil {
+			if !unavailable(err) {
+				s.apiError("Error inspecting container %s: %v", summary.ID, err)
+			}
+			return
+		}
+		if details.ContainerJSONBase == nil || details.HostConfig == nil {
+			continue
+		}
+
+		host := details.HostConfig
+		if host.Privileged {
+			privileged++
+		}
+		if len(host.CapAdd) > 0 {
+			capabilitiesAdded++
+		}
+		if host.IpcMode.IsHost() {
+			shared["ipc"]++
+		}
+		if host.NetworkMode.IsHost() {
+			shared["network"]++
+		}
+		if host.PidMode.IsHost() {
+			shared["pid"]++
+		}
+
+		for _, profile := range unconfinedProfiles {
+			if containerUnconfined(details, profile) {
+				unconfined[profile]++
+			}
+		}
+	}
+
+	c.containersPrivileged.gauge(s.ch, float64(privileged))
+	c.containersCapabilitiesAdded.gauge(s.ch, float64(capabilitiesAdded))
+	for _, namespace := range hostNamespaces {
+		c.containersHostNamespace.gauge(s.ch, float64(shared[namespace]), namespace)
+	}
+	for _, profile := range unconfinedProfiles {
+		c.containersUnconfined.gauge(s.ch, float64(unconfined[profile]), profile)
+	}
+}
+
+// containerUnconfined reports whether a container opted out of a confinement the daemon applies by default
+// Privileged containers are unconfined as well, but are counted on their own
+func containerUnconfined(details container.InspectResponse, profile string) bool {
+	if profile == "userns" {
+		return details.HostConfig.UsernsMode.IsHost()
+	}
+	if profile == "apparmor" && details.AppArmorProfile == "unconfined" {
+		return true
+	}
+	for _, option := range details.HostConfig.SecurityOpt {
+		// The daemon accepts both seccomp=unconfined and the older seccomp:unconfined
+		if option == profile+"=unconfined" || option == profile+":unconfined" {
+			return true
+		}
+	}
+	return false
+}
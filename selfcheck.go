@@ -0,0 +1,165 @@
+package main
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/api/types/network"
+	"github.com/docker/docker/errdefs"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// selfCheckID is the object ID the self-check asks for, so that the calls on objects return as little as possible
+const selfCheckID = "docker-swarm-exporter-self-check"
+
+// endpointCheck is the outcome of the latest check of a Docker API call
+type endpointCheck struct {
+	allowed bool
+	err     string
+}
+
+// endpointChecker checks that the Docker API endpoints the exporter relies on answer, at startup and periodically,
+// without going through the socket proxy mode which stops making denied calls
+type endpointChecker struct {
+	docker  dockerAPI
+	timeout time.Duration
+
+	// caps are the calls of the socket proxy mode, re-allowed when their endpoint answers, nil outside that mode
+	caps *capabilities
+
+	mu     sync.Mutex
+	checks map[string]endpointCheck
+}
+
+// newEndpointChecker creates a checker of the endpoints of a Docker API
+func newEndpointChecker(docker dockerAPI, caps *capabilities, timeout time.Duration) *endpointChecker {
+	return &endpointChecker{docker: docker, timeout: timeout, caps: caps, checks: make(map[string]endpointCheck)}
+}
+
+// call makes a Docker API call, asking for no object when the call allows it
+func (e *endpointChecker) call(ctx context.Context, name string) error {
+	none := filters.NewArgs(filters.Arg("id", selfCheckID))
+	var err error
+	switch name {
+	case "Info":
+		_, err = e.docker.Info(ctx)
+	case "ContainerList":
+		_, err = e.docker.ContainerList(ctx, container.ListOptions{Filters: none})
+	case "ContainerInspect":
+		_, err = e.docker.ContainerInspect(ctx, selfCheckID)
+	case "NetworkList":
+		_, err = e.docker.NetworkList(ctx, network.ListOptions{Filters: none})
+	case "ServiceList":
+		_, err = e.docker.ServiceList(ctx, types.ServiceListOptions{Filters: none})
+	case "TaskList":
+		_, err = e.docker.TaskList(ctx, types.TaskListOptions{Filters: none})
+	case "NodeList":
+		_, err = e.docker.NodeList(ctx, types.NodeListOptions{Filters: none})
+	case "SecretList":
+		_, err = e.docker.SecretList(ctx, types.SecretListOptions{Filters: none})
+	case "ConfigList":
+		_, err = e.docker.ConfigList(ctx, types.ConfigListOptions{Filters: none})
+	case "ServiceLogs":
+		logs, logsErr := e.docker.ServiceLogs(ctx, selfCheckID, container.LogsOptions{ShowStdout: true, Tail: "0"})
+		if logsErr == nil {
+			logs.Close()
+		}
+		err = logsErr
+	}
+	// The endpoint answered when the object asked for does not exist
+	if errdefs.IsNotFound(err) {
+		return nil
+	}
+	return err
+}
+
+// check makes the calls once, logging the endpoints whose outcome changed
+func (e *endpointChecker) check(calls []string) {
+	for _, name := range calls {
+		ctx, cancel := context.WithTimeout(context.Background(), e.timeout)
+		err := e.call(ctx, name)
+		cancel()
+
+		result := endpointCheck{allowed: err == nil}
+		if err != nil {
+			result.err = err.Error()
+		} else if e.caps != nil {
+			e.caps.allow(name)
+		}
+
+		e.mu.Lock()
+		previous, checked := e.checks[name]
+		e.checks[name] = result
+		e.mu.Unlock()
+
+		switch {
+		case !result.allowed && (!checked || previous.allowed):
+			log.Printf("Docker API self-check: %s failed: %v", name, err)
+		case result.allowed && checked && !previous.allowed:
+			log.Printf("Docker API self-check: %s succeeds again", name)
+		}
+	}
+}
+
+// run checks the calls at once and then at every interval until the context is canceled, only once for no interval
+func (e *endpointChecker) run(ctx context.Context, calls []string, interval time.Duration) {
+	e.check(calls)
+	if interval <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			e.check(calls)
+		}
+	}
+}
+
+// result returns the outcome of the latest check of a call, if it was checked
+func (e *endpointChecker) result(name string) (endpointCheck, bool) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	result, ok := e.checks[name]
+	return result, ok
+}
+
+// collect sends whether each checked call succeeded, and the error of those that failed
+func (e *endpointChecker) collect(ch chan<- prometheus.Metric, allowed, failure *metricDesc) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	for _, call := range dockerCalls {
+		result, ok := e.checks[call.Name]
+		if !ok {
+			continue
+		}
+		var value float64
+		if result.allowed {
+			value = 1
+		} else {
+			failure.gauge(ch, 1, call.Name, call.Endpoint, messageValue(result.err))
+		}
+		allowed.gauge(ch, value, call.Name, call.Endpoint)
+	}
+}
+
+// runSelfCheck checks the Docker API endpoints of the calls the collector makes with its options
+func (c *DockerSwarmCollector) runSelfCheck(ctx context.Context, interval time.Duration) {
+	var calls []string
+	for _, view := range c.capabilityReport().Calls {
+		if view.Used {
+			calls = append(calls, view.Call)
+		}
+	}
+	c.selfCheck.run(ctx, calls, interval)
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/docker/docker/api/types/swarm"
+)
+
+// Service labels opting a service into the reachability probes
+const (
+	serviceProbeLabel     = "swarm-exporter.probe"
+	serviceProbePortLabel = "swarm-exporter.probe.port"
+	serviceProbePathLabel = "swarm-exporter.probe.path"
+)
+
+// Reachability probe modules
+const (
+	serviceProbeTCP  = "tcp"
+	serviceProbeHTTP = "http"
+)
+
+// serviceProbeConcurrency limits the number of concurrent reachability probes per scrape
+const serviceProbeConcurrency = 8
+
+// serviceProbeConfig is a probe of the service_probes section of the configuration file
+type serviceProbeConfig struct {
+	Service string `yaml:"service"`
+	Module  string `yaml:"module"`
+	Port    uint32 `yaml:"port"`
+	Path    string `yaml:"path"`
+}
+
+// validate fills in the defaults of a configured probe and checks its module
+func (p *serviceProbeConfig) validate() error {
+	if p.Service == "" {
+		return fmt.Errorf("service probe without a service")
+	}
+	switch p.Module {
+	case "":
+		p.Module = serviceProbeTCP
+	case serviceProbeTCP, serviceProbeHTTP:
+	default:
+		return fmt.Errorf("service probe of %s: unknown module %q, use tcp or http", p.Service, p.Module)
+	}
+	if p.Path == "" {
+		p.Path = "/"
+	}
+	return nil
+}
+
+// serviceProbeResult holds the outcome of the probe of a service
+type serviceProbeResult struct {
+	service  swarm.Service
+	probe    serviceProbeConfig
+	success  bool
+	duration time.Duration
+	status   int
+}
+
+// serviceProbeTarget returns the probe of a service, from the configuration file or its labels, with the port
+// defaulting to its first TCP port published through the ingress network
+func serviceProbeTarget(service swarm.Service, configured map[string]serviceProbeConfig) (serviceProbeConfig, bool) {
+	probe, ok := configured[service.Spec.Name]
+	if !ok {
+		module := service.Spec.Labels[serviceProbeLabel]
+		if module != serviceProbeTCP && module != serviceProbeHTTP {
+			return probe, false
+		}
+		probe = serviceProbeConfig{Service: service.Spec.Name, Module: module, Path: service.Spec.Labels[serviceProbePathLabel]}
+		if port, err := strconv.ParseUint(service.Spec.Labels[serviceProbePortLabel], 10, 32); err == nil {
+			probe.Port = uint32(port)
+		}
+		if probe.Path == "" {
+			probe.Path = "/"
+		}
+	}
+
+	if probe.Port == 0 {
+		ports := ingressProbePorts([]swarm.Service{service}, 1)
+		if len(ports) == 0 {
+			return probe, false
+		}
+		probe.Port = ports[0]
+	}
+	return probe, true
+}
+
+// run connects to the published port, or requests the path over HTTP, a 2xx status being a success
+func (r *serviceProbeResult) run(ctx context.Context, client *http.Client, address string) {
+	target := net.JoinHostPort(address, strconv.FormatUint(uint64(r.probe.Port), 10))
+	start := time.Now()
+	defer func() { r.duration = time.Since(start) }()
+
+	if r.probe.Module == serviceProbeTCP {
+		var dialer net.Dialer
+		conn, err := dialer.DialContext(ctx, "tcp", target)
+		if err != nil {
+			return
+		}
+		conn.Close()
+		r.success = true
+		return
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, "http://"+target+r.probe.Path, nil)
+	if err != nil {
+		return
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return
+	}
+	resp.Body.Close()
+	r.status = resp.StatusCode
+	r.success = resp.StatusCode >= 200 && resp.StatusCode < 300
+}
+
+// collectServiceProbeMetrics probes the published ports of the configured and labeled services on the local node,
+// catching tasks that run without their application listening
+func (c *DockerSwarmCollector) collectServiceProbeMetrics(s *scrape) {
+	services, err := s.services()
+	if err != nil {
+		return
+	}
+
+	var results []serviceProbeResult
+	for _, service := range c.selectedServices(services) {
+		if probe, ok := serviceProbeTarget(service, c.options.ServiceProbes); ok {
+			results = append(results, serviceProbeResult{service: service, probe: probe})
+		}
+	}
+
+	probeCtx, cancel := context.WithTimeout(s.ctx, c.options.ServiceProbeTimeout)
+	defer cancel()
+	// Redirects are reported rather than followed, like the status codes of the other responses
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+
+	sem := make(chan struct{}, serviceProbeConcurrency)
+	var wg sync.WaitGroup
+	for i := range results {
+		wg.Add(1)
+		go func(result *serviceProbeResult) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			result.run(probeCtx, client, c.options.ServiceProbeAddress)
+		}(&results[i])
+	}
+	wg.Wait()
+
+	for _, result := range results {
+		port := strconv.FormatUint(uint64(result.probe.Port), 10)
+		var success float64
+		if result.success {
+			success = 1
+		}
+		c.serviceProbeSuccess.gauge(s.ch, success, c.serviceLabelValues(result.service, result.probe.Module, port)...)
+		c.serviceProbeDuration.gauge(s.ch, result.duration.Seconds(), c.serviceLabelValues(result.service, result.probe.Module, port)...)
+		if result.status != 0 {
+			c.serviceProbeStatusCode.gauge(s.ch, float64(result.status), c.serviceLabelValues(result.service, result.probe.Module, port)...)
+		}
+	}
+}
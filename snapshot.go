@@ -0,0 +1,239 @@
+package main
+
+import (
+	"sort"
+	"time"
+
+	"github.com/docker/docker/api/types/swarm"
+	"github.com/docker/docker/api/types/system"
+)
+
+// snapshot holds the swarm objects fetched by the last successful collection
+type snapshot struct {
+	Taken    time.Time
+	Info     system.Info
+	Services []swarm.Service
+	Nodes    []swarm.Node
+	Tasks    []swarm.Task
+
+	// HasTasks is false when the collection did not list the tasks, e.g. on a standby replica
+	HasTasks bool
+}
+
+// snapshot returns the swarm objects fetched during the scrape
+func (s *scrape) snapshot() *snapshot {
+	return &snapshot{
+		Taken:    s.started,
+		Info:     s.infoResult.value,
+		Services: s.servicesResult.value,
+		Nodes:    s.nodesResult.value,
+		Tasks:    s.tasksResult.value,
+		HasTasks: s.tasksResult.done && s.tasksResult.err == nil,
+	}
+}
+
+// latestSnapshot returns the snapshot of the last successful collection, nil before the first one
+func (c *DockerSwarmCollector) latestSnapshot() *snapshot {
+	c.cache.mu.Lock()
+	defer c.cache.mu.Unlock()
+	return c.cache.snapshot
+}
+
+// serviceView is the state of a service as shown by the exporter
+type serviceView struct {
+	ID          string    `json:"id"`
+	Name        string    `json:"name"`
+	Stack       string    `json:"stack,omitempty"`
+	Image       string    `json:"image"`
+	Mode        string    `json:"mode"`
+	Running     int       `json:"running"`
+	Desired     int       `json:"desired"`
+	Converged   bool      `json:"converged"`
+	UpdateState string    `json:"update_state"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// nodeView is the state of a node as shown by the exporter
+type nodeView struct {
+	ID            string `json:"id"`
+	Hostname      string `json:"hostname"`
+	Role          string `json:"role"`
+	Availability  string `json:"availability"`
+	State         string `json:"state"`
+	Address       string `json:"address"`
+	Reachability  string `json:"reachability,omitempty"`
+	Leader        bool   `json:"leader,omitempty"`
+	EngineVersion string `json:"engine_version"`
+	NanoCPUs      int64  `json:"nano_cpus"`
+	MemoryBytes   int64  `json:"memory_bytes"`
+	Tasks         int    `json:"tasks"`
+}
+
+// taskView is the state of a task as shown by the exporter
+type taskView struct {
+	ID           string    `json:"id"`
+	ServiceID    string    `json:"service_id"`
+	ServiceName  string    `json:"service_name"`
+	Slot         int       `json:"slot,omitempty"`
+	NodeID       string    `json:"node_id,omitempty"`
+	NodeHostname string    `json:"node_hostname,omitempty"`
+	DesiredState string    `json:"desired_state"`
+	State        string    `json:"state"`
+	Message      string    `json:"message,omitempty"`
+	Error        string    `json:"error,omitempty"`
+	ContainerID  string    `json:"container_id,omitempty"`
+	Timestamp    time.Time `json:"timestamp"`
+}
+
+// readyNodes returns the number of ready nodes, the desired task count of global services
+func (snap *snapshot) readyNodes() int {
+	var ready int
+	for _, node := range snap.Nodes {
+		if node.Status.State == swarm.NodeStateReady {
+			ready++
+		}
+	}
+	return ready
+}
+
+// services returns the view of every service, sorted by name
+func (snap *snapshot) services() []serviceView {
+	running := make(map[string]int)
+	for _, task := range snap.Tasks {
+		if task.Status.State == swarm.TaskStateRunning {
+			running[task.ServiceID]++
+		}
+	}
+
+	views := make([]serviceView, 0, len(snap.Services))
+	for _, service := range snap.Services {
+		view := serviceView{
+			ID:          service.ID,
+			Name:        service.Spec.Name,
+			Stack:       service.Spec.Labels[stackNamespaceLabel],
+			Running:     running[service.ID],
+			UpdateState: "none",
+			UpdatedAt:   service.UpdatedAt,
+		}
+		if spec := service.Spec.TaskTemplate.ContainerSpec; spec != nil {
+			view.Image = spec.Image
+		}
+		switch {
+		case service.Spec.Mode.Replicated != nil:
+			view.Mode = "replicated"
+			if service.Spec.Mode.Replicated.Replicas != nil {
+				view.Desired = int(*service.Spec.Mode.Replicated.Replicas)
+			}
+		case service.Spec.Mode.Global != nil:
+			view.Mode = "global"
+			view.Desired = snap.readyNodes()
+		}
+		if service.UpdateStatus != nil && service.UpdateStatus.State != "" {
+			view.UpdateState = string(service.UpdateStatus.State)
+		}
+		view.Converged = view.Running == view.Desired && !updateInProgress(view.UpdateState)
+		views = append(views, view)
+	}
+
+	sort.Slice(views, func(i, j int) bool { return views[i].Name < views[j].Name })
+	return views
+}
+
+// updateInProgress reports whether a service update state is not final
+func updateInProgress(state string) bool {
+	switch swarm.UpdateState(state) {
+	case swarm.UpdateStateUpdating, swarm.UpdateStatePaused, swarm.UpdateStateRollbackStarted, swarm.UpdateStateRollbackPaused:
+		return true
+	}
+	return false
+}
+
+// nodes returns the view of every node, sorted by hostname
+func (snap *snapshot) nodes() []nodeView {
+	running := make(map[string]int)
+	for _, task := range snap.Tasks {
+		if task.Status.State == swarm.TaskStateRunning {
+			running[task.NodeID]++
+		}
+	}
+
+	views := make([]nodeView, 0, len(snap.Nodes))
+	for _, node := range snap.Nodes {
+		view := nodeView{
+			ID:            node.ID,
+			Hostname:      node.Description.Hostname,
+			Role:          string(node.Spec.Role),
+			Availability:  string(node.Spec.Availability),
+			State:         string(node.Status.State),
+			Address:       node.Status.Addr,
+			EngineVersion: node.Description.Engine.EngineVersion,
+			NanoCPUs:      node.Description.Resources.NanoCPUs,
+			MemoryBytes:   node.Description.Resources.MemoryBytes,
+			Tasks:         running[node.ID],
+		}
+		if node.ManagerStatus != nil {
+			view.Reachability = string(node.ManagerStatus.Reachability)
+			view.Leader = node.ManagerStatus.Leader
+		}
+		views = append(views, view)
+	}
+
+	sort.Slice(views, func(i, j int) bool { return views[i].Hostname < views[j].Hostname })
+	return views
+}
+
+// tasks returns the view of every task, most recent status first
+func (snap *snapshot) tasks() []taskView {
+	serviceNames := make(map[string]string, len(snap.Services))
+	for _, service := range snap.Services {
+		serviceNames[service.ID] = service.Spec.Name
+	}
+	nodeHostnames := make(map[string]string, len(snap.Nodes))
+	for _, node := range snap.Nodes {
+		nodeHostnames[node.ID] = node.Description.Hostname
+	}
+
+	views := make([]taskView, 0, len(snap.Tasks))
+	for _, task := range snap.Tasks {
+		view := taskView{
+			ID:           task.ID,
+			ServiceID:    task.ServiceID,
+			ServiceName:  serviceNames[task.ServiceID],
+			Slot:         task.Slot,
+			NodeID:       task.NodeID,
+			NodeHostname: nodeHostnames[task.NodeID],
+			DesiredState: string(task.DesiredState),
+			State:        string(task.Status.State),
+			Message:      task.Status.Message,
+			Error:        task.Status.Err,
+			Timestamp:    task.Status.Timestamp,
+		}
+		if task.Status.ContainerStatus != nil {
+			view.ContainerID = task.Status.ContainerStatus.ContainerID
+		}
+		views = append(views, view)
+	}
+
+	sort.Slice(views, func(i, j int) bool {
+		if !views[i].Timestamp.Equal(views[j].Timestamp) {
+			return views[i].Timestamp.After(views[j].Timestamp)
+		}
+		return views[i].ID < views[j].ID
+	})
+	return views
+}
+
+// recentFailures returns the most recent failed or rejected tasks
+func (snap *snapshot) recentFailures(limit int) []taskView {
+	var failures []taskView
+	for _, task := range snap.tasks() {
+		if task.State != string(swarm.TaskStateFailed) && task.State != string(swarm.TaskStateRejected) {
+			continue
+		}
+		failures = append(failures, task)
+		if len(failures) == limit {
+			break
+		}
+	}
+	return failures
+}
@@ -0,0 +1,202 @@
+package main
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/docker/docker/api/types/mount"
+	"github.com/docker/docker/api/types/swarm"
+)
+
+// collectServiceSpecMetrics collects the configuration of a service audited by policies
+func (c *DockerSwarmCollector) collectServiceSpecMetrics(s *scrape, service swarm.Service) {
+	condition, maxAttempts := serviceRestartPolicy(service)
+	c.serviceRestartPolicy.gauge(s.ch, 1, c.serviceLabelValues(service, string(condition), strconv.FormatUint(maxAttempts, 10))...)
+
+	var healthcheck float64
+	if serviceHealthcheckConfigured(service) {
+		healthcheck = 1
+	}
+	c.serviceHealthcheckConfigured.gauge(s.ch, healthcheck, c.serviceLabelValues(service)...)
+
+	c.collectServiceSecretMetrics(s, service)
+	c.collectServicePortMetrics(s, service)
+	c.collectServiceMountMetrics(s, service)
+
+	if spec := service.Spec.TaskTemplate.ContainerSpec; spec != nil {
+		capabilities := make(map[string]bool, len(spec.CapabilityAdd))
+		for _, capability := range spec.CapabilityAdd {
+			capabilities[labelValue(capability)] = true
+		}
+		for _, capability := range sortedKeys(capabilities) {
+			c.serviceCapabilityAdded.gauge(s.ch, 1, c.serviceLabelValues(service, capability)...)
+		}
+	}
+
+	for _, operation := range []string{"update", "rollback"} {
+		config := serviceUpdateConfig(service, operation)
+		c.serviceUpdateConfig.gauge(s.ch, 1, c.serviceLabelValues(service, operation, config.FailureAction, config.Order)...)
+		c.serviceUpdateParallelism.gauge(s.ch, float64(config.Parallelism), c.serviceLabelValues(service, operation)...)
+		c.serviceUpdateDelay.gauge(s.ch, config.Delay.Seconds(), c.serviceLabelValues(service, operation)...)
+		c.serviceUpdateMonitor.gauge(s.ch, config.Monitor.Seconds(), c.serviceLabelValues(service, operation)...)
+		c.serviceUpdateMaxFailureRatio.gauge(s.ch, float64(config.MaxFailureRatio), c.serviceLabelValues(service, operation)...)
+	}
+}
+
+// serviceRestartPolicy returns the restart condition and maximum attempts of a service, 0 attempts being unlimited
+// Services created without a restart policy get the defaults of the daemon
+func serviceRestartPolicy(service swarm.Service) (swarm.RestartPolicyCondition, uint64) {
+	condition := swarm.RestartPolicyConditionAny
+	if service.Spec.Mode.ReplicatedJob != nil || service.Spec.Mode.GlobalJob != nil {
+		condition = swarm.RestartPolicyConditionOnFailure
+	}
+
+	var maxAttempts uint64
+	if policy := service.Spec.TaskTemplate.RestartPolicy; policy != nil {
+		if policy.Condition != "" {
+			condition = policy.Condition
+		}
+		if policy.MaxAttempts != nil {
+			maxAttempts = *policy.MaxAttempts
+		}
+	}
+	return condition, maxAttempts
+}
+
+// collectServiceSecretMetrics collects the secrets and configs a service uses
+func (c *DockerSwarmCollector) collectServiceSecretMetrics(s *scrape, service swarm.Service) {
+	var secrets []*swarm.SecretReference
+	var configs []*swarm.ConfigReference
+	if spec := service.Spec.TaskTemplate.ContainerSpec; spec != nil {
+		secrets = spec.Secrets
+		configs = spec.Configs
+	}
+
+	// A secret or config mounted at several paths counts once
+	secretNames := make(map[string]bool, len(secrets))
+	for _, secret := range secrets {
+		secretNames[labelValue(secret.SecretName)] = true
+	}
+	configNames := make(map[string]bool, len(configs))
+	for _, config := range configs {
+		configNames[labelValue(config.ConfigName)] = true
+	}
+
+	c.serviceSecrets.gauge(s.ch, float64(len(secretNames)), c.serviceLabelValues(service)...)
+	c.serviceConfigs.gauge(s.ch, float64(len(configNames)), c.serviceLabelValues(service)...)
+
+	if !c.options.SecretReferences {
+		return
+	}
+	for _, name := range sortedKeys(secretNames) {
+		c.serviceSecretReference.gauge(s.ch, 1, c.serviceLabelValues(service, name)...)
+	}
+	for _, name := range sortedKeys(configNames) {
+		c.serviceConfigReference.gauge(s.ch, 1, c.serviceLabelValues(service, name)...)
+	}
+}
+
+// portProtocols and publishModes list the protocols and publish modes of ports, all of which are always exposed
+var (
+	portProtocols = []swarm.PortConfigProtocol{swarm.PortConfigProtocolTCP, swarm.PortConfigProtocolUDP, swarm.PortConfigProtocolSCTP}
+	publishModes  = []swarm.PortConfigPublishMode{swarm.PortConfigPublishModeIngress, swarm.PortConfigPublishModeHost}
+)
+
+// collectServicePortMetrics collects the number of ports a service publishes by protocol and publish mode
+func (c *DockerSwarmCollector) collectServicePortMetrics(s *scrape, service swarm.Service) {
+	counts := make(map[swarm.PortConfigProtocol]map[swarm.PortConfigPublishMode]int, len(portProtocols))
+	for _, protocol := range portProtocols {
+		counts[protocol] = make(map[swarm.PortConfigPublishMode]int, len(publishModes))
+	}
+	for _, port := range service.Endpoint.Ports {
+		protocol, mode := port.Protocol, port.PublishMode
+		if protocol == "" {
+			protocol = swarm.PortConfigProtocolTCP
+		}
+		if mode == "" {
+			mode = swarm.PortConfigPublishModeIngress
+		}
+		if _, ok := counts[protocol]; ok {
+			counts[protocol][mode]++
+		}
+	}
+
+	for _, protocol := range portProtocols {
+		for _, mode := range publishModes {
+			c.servicePublishedPorts.gauge(s.ch, float64(counts[protocol][mode]), c.serviceLabelValues(service, string(protocol), string(mode))...)
+		}
+	}
+}
+
+// mountTypes lists the mount types that are always exposed, other types only being exposed when used
+var mountTypes = []mount.Type{mount.TypeBind, mount.TypeVolume, mount.TypeTmpfs}
+
+// collectServiceMountMetrics collects the number of mounts of a service by type, and the sources of its bind mounts
+func (c *DockerSwarmCollector) collectServiceMountMetrics(s *scrape, service swarm.Service) {
+	var mounts []mount.Mount
+	if spec := service.Spec.TaskTemplate.ContainerSpec; spec != nil {
+		mounts = spec.Mounts
+	}
+
+	counts := make(map[string]int, len(mountTypes))
+	for _, mountType := range mountTypes {
+		counts[string(mountType)] = 0
+	}
+	// A host path mounted several times is writable when any of its mounts is
+	writable := make(map[string]bool)
+	for _, m := range mounts {
+		counts[labelValue(string(m.Type))]++
+		if m.Type == mount.TypeBind {
+			source := labelValue(m.Source)
+			writable[source] = writable[source] || !m.ReadOnly
+		}
+	}
+
+	for _, mountType := range sortedKeys(counts) {
+		c.serviceMounts.gauge(s.ch, float64(counts[mountType]), c.serviceLabelValues(service, mountType)...)
+	}
+
+	if !c.options.BindMounts {
+		return
+	}
+	for _, source := range sortedKeys(writable) {
+		c.serviceBindMount.gauge(s.ch, 1, c.serviceLabelValues(service, source, strconv.FormatBool(!writable[source]))...)
+	}
+}
+
+// serviceHealthcheckConfigured reports whether the container spec of a service defines a healthcheck
+// A healthcheck of NONE disables the one of the image and does not count
+func serviceHealthcheckConfigured(service swarm.Service) bool {
+	spec := service.Spec.TaskTemplate.ContainerSpec
+	if spec == nil || spec.Healthcheck == nil || len(spec.Healthcheck.Test) == 0 {
+		return false
+	}
+	return spec.Healthcheck.Test[0] != "NONE"
+}
+
+// defaultUpdateMonitor is how long the daemon monitors updated tasks for failures when the service does not say
+const defaultUpdateMonitor = 5 * time.Second
+
+// serviceUpdateConfig returns the update or rollback configuration of a service, with the defaults of the daemon
+// filled in for the configuration or fields the service does not set
+func serviceUpdateConfig(service swarm.Service, operation string) swarm.UpdateConfig {
+	config := service.Spec.UpdateConfig
+	if operation == "rollback" {
+		config = service.Spec.RollbackConfig
+	}
+
+	result := swarm.UpdateConfig{Parallelism: 1}
+	if config != nil {
+		result = *config
+	}
+	if result.FailureAction == "" {
+		result.FailureAction = swarm.UpdateFailureActionPause
+	}
+	if result.Order == "" {
+		result.Order = swarm.UpdateOrderStopFirst
+	}
+	if result.Monitor == 0 {
+		result.Monitor = defaultUpdateMonitor
+	}
+	return result
+}
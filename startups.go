@@ -0,0 +1,108 @@
+package main
+
+import (
+	"maps"
+	"sync"
+	"time"
+
+	"github.com/docker/docker/api/types/swarm"
+)
+
+// startBuckets are the upper bounds of docker_container_start_duration_seconds
+var startBuckets = []float64{1, 2, 5, 10, 30, 60, 120, 300}
+
+// serviceStartups holds the start duration statistics of a service
+type serviceStartups struct {
+	// running holds the tasks seen running at the previous scrape, which were observed already
+	running map[string]bool
+
+	count   uint64
+	sum     float64
+	buckets map[float64]uint64
+	seen    time.Time
+}
+
+// startupTracker observes how long the tasks of every service take to start across scrapes
+type startupTracker struct {
+	mu       sync.Mutex
+	services map[string]*serviceStartups
+}
+
+// newStartupTracker creates an empty tracker
+func newStartupTracker() *startupTracker {
+	return &startupTracker{services: make(map[string]*serviceStartups)}
+}
+
+// clone returns a copy of the tracker sharing no state with it
+func (t *startupTracker) clone() *startupTracker {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	c := newStartupTracker()
+	for service, st := range t.services {
+		copied := *st
+		copied.running = maps.Clone(st.running)
+		copied.buckets = maps.Clone(st.buckets)
+		c.services[service] = &copied
+	}
+	return c
+}
+
+// observe records the tasks of a service that started running since the previous scrape and returns a copy of its
+// statistics. A task took from its creation, which includes scheduling and pulling the image, to its last state change
+// to start. The tasks already running when a service is first seen started before the exporter and are not observed
+func (t *startupTracker) observe(service string, at time.Time, tasks []swarm.Task) serviceStartups {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	st, ok := t.services[service]
+	if !ok {
+		st = &serviceStartups{buckets: make(map[float64]uint64, len(startBuckets))}
+		t.services[service] = st
+	}
+	st.seen = at
+
+	running := make(map[string]bool)
+	for _, task := range tasks {
+		if task.Status.State != swarm.TaskStateRunning {
+			continue
+		}
+		running[task.ID] = true
+		if !ok || st.running[task.ID] || task.CreatedAt.IsZero() || task.Status.Timestamp.Before(task.CreatedAt) {
+			continue
+		}
+
+		duration := task.Status.Timestamp.Sub(task.CreatedAt).Seconds()
+		st.count++
+		st.sum += duration
+		for _, bound := range startBuckets {
+			if duration <= bound {
+				st.buckets[bound]++
+			}
+		}
+	}
+	st.running = running
+	return st.copy()
+}
+
+// copy returns the statistics with their own buckets, safe to use without the lock
+func (st *serviceStartups) copy() serviceStartups {
+	c := *st
+	c.running = nil
+	c.buckets = make(map[float64]uint64, len(st.buckets))
+	for bound, count := range st.buckets {
+		c.buckets[bound] = count
+	}
+	return c
+}
+
+// prune forgets the services not observed for a while
+func (t *startupTracker) prune(now time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for service, st := range t.services {
+		if now.Sub(st.seen) > outageTrackerRetention {
+			delete(t.services, service)
+		}
+	}
+}
@@ -0,0 +1,374 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/api/types/network"
+	"github.com/docker/docker/api/types/swarm"
+	"github.com/docker/docker/api/types/system"
+	"github.com/docker/docker/errdefs"
+	"github.com/docker/docker/pkg/stdcopy"
+)
+
+// dockerState holds every Docker API object read by the collector
+type dockerState struct {
+	Created time.Time `json:"created"`
+	Version string    `json:"version"`
+
+	Info       system.Info         `json:"info"`
+	Containers []container.Summary `json:"containers"`
+	Services   []swarm.Service     `json:"services"`
+	Tasks      []swarm.Task        `json:"tasks"`
+	Nodes      []swarm.Node        `json:"nodes"`
+	Networks   []network.Summary   `json:"networks"`
+
+	// ContainerDetails holds the inspected running containers
+	ContainerDetails []container.InspectResponse `json:"container_details,omitempty"`
+
+	// Secrets and Configs hold the metadata of the swarm secrets and configs, without their data
+	Secrets []swarm.Secret `json:"secrets,omitempty"`
+	Configs []swarm.Config `json:"configs,omitempty"`
+
+	// ServiceLogs maps a service ID to its log lines, each starting with its timestamp; dump-state leaves logs out
+	ServiceLogs map[string][]string `json:"service_logs,omitempty"`
+
+	// Errors maps a Docker API call to the error it fails with, to test failures
+	Errors map[string]string `json:"errors,omitempty"`
+}
+
+// fetchState reads every object the collector uses from the Docker API
+func fetchState(ctx context.Context, docker dockerAPI) (*dockerState, error) {
+	state := &dockerState{Created: time.Now().UTC(), Version: Version}
+
+	var err error
+	if state.Info, err = docker.Info(ctx); err != nil {
+		return nil, fmt.Errorf("getting Docker info: %w", err)
+	}
+	if state.Containers, err = docker.ContainerList(ctx, container.ListOptions{All: true}); err != nil {
+		return nil, fmt.Errorf("listing containers: %w", err)
+	}
+	for _, c := range state.Containers {
+		if c.State != "running" {
+			continue
+		}
+		details, err := docker.ContainerInspect(ctx, c.ID)
+		if errdefs.IsNotFound(err) {
+			// The container was removed since it was listed
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("inspecting container %s: %w", c.ID, err)
+		}
+		state.ContainerDetails = append(state.ContainerDetails, details)
+	}
+	if state.Networks, err = docker.NetworkList(ctx, network.ListOptions{}); err != nil {
+		return nil, fmt.Errorf("listing networks: %w", err)
+	}
+
+	// Only managers can list swarm objects
+	if state.Info.Swarm.ControlAvailable {
+		if state.Services, err = docker.ServiceList(ctx, types.ServiceListOptions{}); err != nil {
+			return nil, fmt.Errorf("listing services: %w", err)
+		}
+		if state.Tasks, err = docker.TaskList(ctx, types.TaskListOptions{}); err != nil {
+			return nil, fmt.Errorf("listing tasks: %w", err)
+		}
+		if state.Nodes, err = docker.NodeList(ctx, types.NodeListOptions{}); err != nil {
+			return nil, fmt.Errorf("listing nodes: %w", err)
+		}
+		if state.Secrets, err = docker.SecretList(ctx, types.SecretListOptions{}); err != nil {
+			return nil, fmt.Errorf("listing secrets: %w", err)
+		}
+		if state.Configs, err = docker.ConfigList(ctx, types.ConfigListOptions{}); err != nil {
+			return nil, fmt.Errorf("listing configs: %w", err)
+		}
+	}
+	return state, nil
+}
+
+// redact drops the environment of containers, services and tasks, and the data of configs, which often hold credentials
+func (state *dockerState) redact() {
+	for i := range state.ContainerDetails {
+		if config := state.ContainerDetails[i].Config; config != nil {
+			config.Env = nil
+		}
+	}
+	for i := range state.Services {
+		if spec := state.Services[i].Spec.TaskTemplate.ContainerSpec; spec != nil {
+			spec.Env = nil
+		}
+		if previous := state.Services[i].PreviousSpec; previous != nil && previous.TaskTemplate.ContainerSpec != nil {
+			previous.TaskTemplate.ContainerSpec.Env = nil
+		}
+	}
+	for i := range state.Tasks {
+		if spec := state.Tasks[i].Spec.ContainerSpec; spec != nil {
+			spec.Env = nil
+		}
+	}
+	for i := range state.Configs {
+		state.Configs[i].Spec.Data = nil
+	}
+}
+
+// clusterID returns the ID of the swarm the state was taken from
+func (state *dockerState) clusterID() string {
+	if state.Info.Swarm.Cluster == nil {
+		return ""
+	}
+	return state.Info.Swarm.Cluster.ID
+}
+
+// err returns the configured error of a Docker API call
+func (state *dockerState) err(call string) error {
+	if message, ok := state.Errors[call]; ok {
+		return errors.New(message)
+	}
+	return nil
+}
+
+// fixtureFiles maps the files of a fixture directory to the objects they hold
+func (state *dockerState) fixtureFiles() map[string]any {
+	return map[string]any{
+		"info.json":       &state.Info,
+		"containers.json": &state.Containers,
+		"services.json":   &state.Services,
+		"tasks.json":      &state.Tasks,
+		"nodes.json":      &state.Nodes,
+		"networks.json":   &state.Networks,
+		"errors.json":     &state.Errors,
+		"secrets.json":    &state.Secrets,
+		"configs.json":    &state.Configs,
+
+		"container_details.json": &state.ContainerDetails,
+		"service_logs.json":      &state.ServiceLogs,
+	}
+}
+
+// readFixture loads a fixture directory holding one JSON file per object type,
+// missing files leave the objects empty
+func readFixture(dir string) (*dockerState, error) {
+	state := &dockerState{}
+	for name, target := range state.fixtureFiles() {
+		data, err := os.ReadFile(filepath.Join(dir, name))
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(data, target); err != nil {
+			return nil, fmt.Errorf("parsing %s: %w", name, err)
+		}
+	}
+	return state, nil
+}
+
+// readState loads a state bundle written by dump-state
+func readState(path string) (*dockerState, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var state dockerState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", path, err)
+	}
+	return &state, nil
+}
+
+// dumpState writes the state of the configured daemon as a JSON bundle to the path, or to stdout when empty
+func dumpState(path string) error {
+	dockerClient, err := newDockerClient(*dockerSocket, nil, tlsSettings{})
+	if err != nil {
+		return fmt.Errorf("creating Docker client: %w", err)
+	}
+	defer dockerClient.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), *scrapeTimeout)
+	defer cancel()
+
+	state, err := fetchState(ctx, dockerClient)
+	if err != nil {
+		return err
+	}
+	state.redact()
+
+	var out io.Writer = os.Stdout
+	if path != "" {
+		f, err := os.Create(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		out = f
+	}
+
+	encoder := json.NewEncoder(out)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(state)
+}
+
+// staticDocker serves Docker API objects from memory instead of a daemon
+type staticDocker struct {
+	state *dockerState
+}
+
+// Info implements the dockerAPI interface
+func (d staticDocker) Info(ctx context.Context) (system.Info, error) {
+	if err := d.state.err("Info"); err != nil {
+		return system.Info{}, err
+	}
+	return d.state.Info, nil
+}
+
+// ContainerList implements the dockerAPI interface
+func (d staticDocker) ContainerList(ctx context.Context, options container.ListOptions) ([]container.Summary, error) {
+	if err := d.state.err("ContainerList"); err != nil {
+		return nil, err
+	}
+	if options.All {
+		return d.state.Containers, nil
+	}
+
+	var running []container.Summary
+	for _, c := range d.state.Containers {
+		if c.State == "running" {
+			running = append(running, c)
+		}
+	}
+	return running, nil
+}
+
+// ContainerInspect implements the dockerAPI interface
+func (d staticDocker) ContainerInspect(ctx context.Context, containerID string) (container.InspectResponse, error) {
+	if err := d.state.err("ContainerInspect"); err != nil {
+		return container.InspectResponse{}, err
+	}
+	for _, details := range d.state.ContainerDetails {
+		if details.ContainerJSONBase != nil && details.ID == containerID {
+			return details, nil
+		}
+	}
+	return container.InspectResponse{}, errdefs.NotFound(fmt.Errorf("no such container: %s", containerID))
+}
+
+// NetworkList implements the dockerAPI interface
+func (d staticDocker) NetworkList(ctx context.Context, options network.ListOptions) ([]network.Summary, error) {
+	if err := d.state.err("NetworkList"); err != nil {
+		return nil, err
+	}
+	return d.state.Networks, nil
+}
+
+// ServiceList implements the dockerAPI interface
+func (d staticDocker) ServiceList(ctx context.Context, options types.ServiceListOptions) ([]swarm.Service, error) {
+	if err := d.state.err("ServiceList"); err != nil {
+		return nil, err
+	}
+	// Callers may reorder the result, which must not race with other scrapes
+	return slices.Clone(d.state.Services), nil
+}
+
+// TaskList implements the dockerAPI interface, applying the service, node and desired-state filters
+func (d staticDocker) TaskList(ctx context.Context, options types.TaskListOptions) ([]swarm.Task, error) {
+	if err := d.state.err("TaskList"); err != nil {
+		return nil, err
+	}
+	if options.Filters.Len() == 0 {
+		return slices.Clone(d.state.Tasks), nil
+	}
+
+	serviceNames := make(map[string]string, len(d.state.Services))
+	for _, service := range d.state.Services {
+		serviceNames[service.ID] = service.Spec.Name
+	}
+	nodeHostnames := make(map[string]string, len(d.state.Nodes))
+	for _, node := range d.state.Nodes {
+		nodeHostnames[node.ID] = node.Description.Hostname
+	}
+
+	var tasks []swarm.Task
+	for _, task := range d.state.Tasks {
+		if !matchesFilter(options.Filters, "service", task.ServiceID, serviceNames[task.ServiceID]) ||
+			!matchesFilter(options.Filters, "node", task.NodeID, nodeHostnames[task.NodeID]) ||
+			!matchesFilter(options.Filters, "desired-state", string(task.DesiredState)) {
+			continue
+		}
+		tasks = append(tasks, task)
+	}
+	return tasks, nil
+}
+
+// NodeList implements the dockerAPI interface
+func (d staticDocker) NodeList(ctx context.Context, options types.NodeListOptions) ([]swarm.Node, error) {
+	if err := d.state.err("NodeList"); err != nil {
+		return nil, err
+	}
+	return slices.Clone(d.state.Nodes), nil
+}
+
+// SecretList implements the dockerAPI interface
+func (d staticDocker) SecretList(ctx context.Context, options types.SecretListOptions) ([]swarm.Secret, error) {
+	if err := d.state.err("SecretList"); err != nil {
+		return nil, err
+	}
+	return slices.Clone(d.state.Secrets), nil
+}
+
+// ConfigList implements the dockerAPI interface
+func (d staticDocker) ConfigList(ctx context.Context, options types.ConfigListOptions) ([]swarm.Config, error) {
+	if err := d.state.err("ConfigList"); err != nil {
+		return nil, err
+	}
+	return slices.Clone(d.state.Configs), nil
+}
+
+// ServiceLogs implements the dockerAPI interface
+// The lines are written to the stdout stream, multiplexed like the logs of a container without a TTY
+func (d staticDocker) ServiceLogs(ctx context.Context, serviceID string, options container.LogsOptions) (io.ReadCloser, error) {
+	if err := d.state.err("ServiceLogs"); err != nil {
+		return nil, err
+	}
+	lines := d.state.ServiceLogs[serviceID]
+	if tail, err := strconv.Atoi(options.Tail); err == nil && tail < len(lines) {
+		lines = lines[len(lines)-tail:]
+	}
+
+	var buf bytes.Buffer
+	stdout := stdcopy.NewStdWriter(&buf, stdcopy.Stdout)
+	for _, line := range lines {
+		if _, err := stdout.Write([]byte(line + "\n")); err != nil {
+			return nil, err
+		}
+	}
+	return io.NopCloser(&buf), nil
+}
+
+// matchesFilter reports whether one of the values is accepted by the filter of the given key
+func matchesFilter(args filters.Args, key string, values ...string) bool {
+	if !args.Contains(key) {
+		return true
+	}
+	for _, value := range values {
+		if value != "" && args.ExactMatch(key, value) {
+			return true
+		}
+	}
+	return false
+}
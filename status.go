@@ -0,0 +1,98 @@
+package main
+
+import (
+	"html/template"
+	"log"
+	"net/http"
+	"time"
+)
+
+// statusFailureLimit is the number of recent task failures shown on the status page
+const statusFailureLimit = 20
+
+// statusTemplate renders the cluster status page
+var statusTemplate = template.Must(template.New("status").Parse(`<html>
+<head>
+<title>Docker Swarm Status</title>
+<style>
+body { font-family: sans-serif; }
+table { border-collapse: collapse; margin-bottom: 2em; }
+th, td { border: 1px solid #ccc; padding: 0.2em 0.6em; text-align: left; }
+.bad { color: #b00; }
+</style>
+</head>
+<body>
+<h1>Docker Swarm Status</h1>
+{{if not .Snapshot}}
+<p>No successful collection yet.</p>
+{{else}}
+<p>Collected {{.Snapshot.Taken.Format "2006-01-02 15:04:05 MST"}} ({{.Age}} ago){{if .Snapshot.Info.Name}} on {{.Snapshot.Info.Name}}{{end}}.</p>
+
+<h2>Services</h2>
+<table>
+<tr><th>Name</th><th>Stack</th><th>Mode</th><th>Running / Desired</th><th>Update</th></tr>
+{{range .Services}}
+<tr>
+<td>{{.Name}}</td><td>{{.Stack}}</td><td>{{.Mode}}</td>
+<td{{if lt .Running .Desired}} class="bad"{{end}}>{{if $.Snapshot.HasTasks}}{{.Running}}{{else}}?{{end}} / {{.Desired}}</td>
+<td>{{.UpdateState}}</td>
+</tr>
+{{end}}
+</table>
+
+<h2>Nodes</h2>
+<table>
+<tr><th>Hostname</th><th>Role</th><th>Availability</th><th>State</th><th>Engine</th></tr>
+{{range .Nodes}}
+<tr>
+<td>{{.Hostname}}</td><td>{{.Role}}</td><td>{{.Availability}}</td>
+<td{{if ne .State "ready"}} class="bad"{{end}}>{{.State}}</td><td>{{.EngineVersion}}</td>
+</tr>
+{{end}}
+</table>
+
+<h2>Recent task failures</h2>
+{{if not .Snapshot.HasTasks}}
+<p>Tasks were not listed by the last collection.</p>
+{{else if not .Failures}}
+<p>No failed tasks.</p>
+{{else}}
+<table>
+<tr><th>Time</th><th>Service</th><th>Slot</th><th>Node</th><th>State</th><th>Error</th></tr>
+{{range .Failures}}
+<tr>
+<td>{{.Timestamp.Format "2006-01-02 15:04:05"}}</td><td>{{.ServiceName}}</td><td>{{.Slot}}</td>
+<td>{{.NodeHostname}}</td><td>{{.State}}</td><td>{{if .Error}}{{.Error}}{{else}}{{.Message}}{{end}}</td>
+</tr>
+{{end}}
+</table>
+{{end}}
+{{end}}
+</body>
+</html>
+`))
+
+// statusPage is the data rendered by the status template
+type statusPage struct {
+	Snapshot *snapshot
+	Age      time.Duration
+	Services []serviceView
+	Nodes    []nodeView
+	Failures []taskView
+}
+
+// statusHandler renders the state of the swarm from the last successful collection
+func (c *DockerSwarmCollector) statusHandler(w http.ResponseWriter, r *http.Request) {
+	page := statusPage{Snapshot: c.latestSnapshot()}
+	if page.Snapshot != nil {
+		page.Age = time.Since(page.Snapshot.Taken).Round(time.Second)
+		page.Services = page.Snapshot.services()
+		page.Nodes = page.Snapshot.nodes()
+		page.Failures = page.Snapshot.recentFailures(statusFailureLimit)
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := statusTemplate.Execute(w, page); err != nil {
+		log.Printf("Error rendering status page: %v", err)
+	}
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"sync"
+
+	"github.com/docker/docker/api/types/swarm"
+)
+
+// collectClusterMetrics collects the configuration of the swarm from the info of the manager
+func (c *DockerSwarmCollector) collectClusterMetrics(s *scrape) {
+	info, err := s.info()
+	if err != nil || info.Swarm.Cluster == nil {
+		return
+	}
+	cluster := info.Swarm.Cluster
+	c.clusterCreated.gauge(s.ch, timestampSeconds(cluster.CreatedAt))
+	c.clusterUpdated.gauge(s.ch, timestampSeconds(cluster.UpdatedAt))
+
+	spec := cluster.Spec
+
+	raft := spec.Raft
+	c.raftSnapshotInterval.gauge(s.ch, float64(raft.SnapshotInterval))
+	if raft.KeepOldSnapshots != nil {
+		c.raftKeepOldSnapshots.gauge(s.ch, float64(*raft.KeepOldSnapshots))
+	}
+	c.raftLogEntriesForSlowFollowers.gauge(s.ch, float64(raft.LogEntriesForSlowFollowers))
+	c.raftHeartbeatTick.gauge(s.ch, float64(raft.HeartbeatTick))
+	c.raftElectionTick.gauge(s.ch, float64(raft.ElectionTick))
+
+	if limit := spec.Orchestration.TaskHistoryRetentionLimit; limit != nil {
+		c.taskHistoryRetentionLimit.gauge(s.ch, float64(*limit))
+	}
+	c.dispatcherHeartbeatPeriod.gauge(s.ch, spec.Dispatcher.HeartbeatPeriod.Seconds())
+	c.nodeCertExpiry.gauge(s.ch, spec.CAConfig.NodeCertExpiry.Seconds())
+
+	var autolock float64
+	if spec.EncryptionConfig.AutoLockManagers {
+		autolock = 1
+	}
+	c.autolockManagers.gauge(s.ch, autolock)
+}
+
+// leaderTracker counts the changes of the raft leader observed across scrapes
+type leaderTracker struct {
+	mu      sync.Mutex
+	leader  string
+	changes uint64
+}
+
+// clone returns a copy of the tracker sharing no state with it
+func (t *leaderTracker) clone() *leaderTracker {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return &leaderTracker{leader: t.leader, changes: t.changes}
+}
+
+// observe records the current leader among the nodes and returns the number of changes seen so far
+// A scrape finding no leader, e.g. during an election, leaves the last known leader in place
+func (t *leaderTracker) observe(nodes []swarm.Node) uint64 {
+	var leader string
+	for _, node := range nodes {
+		if node.ManagerStatus != nil && node.ManagerStatus.Leader {
+			leader = node.ID
+		}
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if leader != "" && leader != t.leader {
+		if t.leader != "" {
+			t.changes++
+		}
+		t.leader = leader
+	}
+	return t.changes
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/docker/docker/api/types/swarm"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/model"
+)
+
+// tenantPath prefixes the name of a tenant in the path of its metrics endpoint
+const tenantPath = "/metrics/tenant/"
+
+// defaultTenantLabel is the Prometheus label holding the tenant when the tenants section names none
+const defaultTenantLabel = "tenant"
+
+// tenantConfig is the tenants section of the configuration file, assigning services to the teams sharing a swarm
+type tenantConfig struct {
+	// Label is the Prometheus label holding the tenant of a service
+	Label string `yaml:"label"`
+
+	// DockerLabel is the service label whose value is the tenant of a service, taking precedence over its stack
+	DockerLabel string `yaml:"docker_label"`
+
+	// Stacks lists the stack namespaces of every tenant
+	Stacks map[string][]string `yaml:"stacks"`
+
+	// SharedMetrics adds the metrics that belong to no service, such as node metrics, to the endpoints of the tenants
+	SharedMetrics bool `yaml:"shared_metrics"`
+
+	// Quotas limit the series of the services of a tenant, DefaultQuota those of the other tenants, 0 for no limit
+	Quotas       map[string]int `yaml:"quotas"`
+	DefaultQuota int            `yaml:"default_quota"`
+}
+
+// tenantRules assigns services to tenants
+type tenantRules struct {
+	label       string
+	dockerLabel string
+	stacks      map[string]string
+	shared      bool
+
+	quotas       map[string]int
+	defaultQuota int
+}
+
+// parseTenants validates the tenants section, an empty section leaving the tenant label out
+func parseTenants(config tenantConfig) (tenantRules, error) {
+	if config.DockerLabel == "" && len(config.Stacks) == 0 {
+		return tenantRules{}, nil
+	}
+
+	rules := tenantRules{
+		label:       config.Label,
+		dockerLabel: config.DockerLabel,
+		stacks:      make(map[string]string),
+		shared:      config.SharedMetrics,
+
+		quotas:       config.Quotas,
+		defaultQuota: config.DefaultQuota,
+	}
+	if rules.label == "" {
+		rules.label = defaultTenantLabel
+	}
+	switch rules.label {
+	case "service_id", "service_name", "stack", "cluster_id", "cluster_name":
+		return tenantRules{}, fmt.Errorf("tenant label %s is already used by the exporter", rules.label)
+	}
+	if !model.LabelName(rules.label).IsValidLegacy() {
+		return tenantRules{}, fmt.Errorf("invalid tenant label %q", rules.label)
+	}
+	if rules.defaultQuota < 0 {
+		return tenantRules{}, fmt.Errorf("default tenant quota must not be negative")
+	}
+	for tenant, quota := range rules.quotas {
+		if quota < 0 {
+			return tenantRules{}, fmt.Errorf("quota of tenant %s must not be negative", tenant)
+		}
+	}
+
+	for _, tenant := range sortedKeys(config.Stacks) {
+		for _, stack := range config.Stacks[tenant] {
+			if other, ok := rules.stacks[stack]; ok {
+				return tenantRules{}, fmt.Errorf("stack %s belongs to both tenants %s and %s", stack, other, tenant)
+			}
+			rules.stacks[stack] = tenant
+		}
+	}
+	return rules, nil
+}
+
+// enabled reports whether the per-service metrics carry the tenant label
+func (r tenantRules) enabled() bool {
+	return r.label != ""
+}
+
+// tenant returns the tenant of a service: the value of its Docker label, or the tenant listing its stack,
+// empty when neither assigns it
+func (r tenantRules) tenant(service swarm.Service) string {
+	if r.dockerLabel != "" {
+		if tenant := service.Spec.Labels[r.dockerLabel]; tenant != "" {
+			return labelValue(tenant)
+		}
+	}
+	return r.stacks[service.Spec.Labels[stackNamespaceLabel]]
+}
+
+// tenantGatherer keeps the metrics of the services of one tenant, and the shared metrics when enabled
+type tenantGatherer struct {
+	next   prometheus.Gatherer
+	rules  tenantRules
+	tenant string
+}
+
+// Gather implements the prometheus.Gatherer interface
+func (g tenantGatherer) Gather() ([]*dto.MetricFamily, error) {
+	gathered, err := g.next.Gather()
+
+	var families []*dto.MetricFamily
+	for _, family := range gathered {
+		var metrics []*dto.Metric
+		for _, metric := range family.GetMetric() {
+			if g.selected(metric) {
+				metrics = append(metrics, metric)
+			}
+		}
+		if len(metrics) == 0 {
+			continue
+		}
+		families = append(families, &dto.MetricFamily{Name: family.Name, Help: family.Help, Type: family.Type, Metric: metrics})
+	}
+	return families, err
+}
+
+// selected reports whether a metric belongs to the tenant, or is shared by all tenants and those are exposed
+func (g tenantGatherer) selected(metric *dto.Metric) bool {
+	if tenant, ok := metricTenant(metric, g.rules.label); ok {
+		return tenant == g.tenant
+	}
+	return g.rules.shared
+}
+
+// tenantHandler serves the metrics of the tenant named by the path, filtered from those of a gatherer
+func tenantHandler(gatherer prometheus.Gatherer, rules tenantRules) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		tenant := strings.TrimPrefix(r.URL.Path, tenantPath)
+		if tenant == "" || strings.Contains(tenant, "/") {
+			http.NotFound(w, r)
+			return
+		}
+		promhttp.HandlerFor(tenantGatherer{next: gatherer, rules: rules, tenant: tenant}, promhttp.HandlerOpts{}).ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+)
+
+// tlsReloadInterval is how often the certificate files are checked for changes
+const tlsReloadInterval = 30 * time.Second
+
+// certReloader serves the web server certificate, reloading it when its files change
+type certReloader struct {
+	certFile string
+	keyFile  string
+
+	mu       sync.Mutex
+	cert     *tls.Certificate
+	modified time.Time
+}
+
+// newCertReloader loads the certificate and key, failing when they cannot be loaded
+func newCertReloader(certFile, keyFile string) (*certReloader, error) {
+	r := &certReloader{certFile: certFile, keyFile: keyFile}
+	if _, err := r.reload(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// lastModified returns the latest modification time of the certificate and key files
+func (r *certReloader) lastModified() (time.Time, error) {
+	var latest time.Time
+	for _, path := range []string{r.certFile, r.keyFile} {
+		info, err := os.Stat(path)
+		if err != nil {
+			return time.Time{}, err
+		}
+		if info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+	}
+	return latest, nil
+}
+
+// reload loads the certificate again when its files changed since the last load, reporting whether it did
+// The previous certificate is kept when the new one cannot be loaded, e.g. while only one of the files was replaced
+func (r *certReloader) reload() (bool, error) {
+	modified, err := r.lastModified()
+	if err != nil {
+		return false, err
+	}
+
+	r.mu.Lock()
+	unchanged := r.cert != nil && modified.Equal(r.modified)
+	r.mu.Unlock()
+	if unchanged {
+		return false, nil
+	}
+
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return false, fmt.Errorf("loading TLS certificate: %w", err)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.cert = &cert
+	r.modified = modified
+	return true, nil
+}
+
+// run checks the certificate files for changes until the context is done
+func (r *certReloader) run(ctx context.Context) {
+	ticker := time.NewTicker(tlsReloadInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			reloaded, err := r.reload()
+			if err != nil {
+				log.Printf("Error reloading TLS certificate, keeping the current one: %v", err)
+			} else if reloaded {
+				log.Printf("Reloaded TLS certificate %s", r.certFile)
+			}
+		}
+	}
+}
+
+// getCertificate implements the tls.Config GetCertificate callback
+func (r *certReloader) getCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.cert, nil
+}
+
+// tlsVersions maps the accepted --tls.min-version values to TLS versions
+var tlsVersions = map[string]uint16{
+	"TLS10": tls.VersionTLS10,
+	"TLS11": tls.VersionTLS11,
+	"TLS12": tls.VersionTLS12,
+	"TLS13": tls.VersionTLS13,
+}
+
+// tlsCurveIDs maps the accepted --tls.curves values to curves
+var tlsCurveIDs = map[string]tls.CurveID{
+	"X25519":         tls.X25519,
+	"P256":           tls.CurveP256,
+	"P384":           tls.CurveP384,
+	"P521":           tls.CurveP521,
+	"X25519MLKEM768": tls.X25519MLKEM768,
+}
+
+// tlsSettings restricts the protocol versions, cipher suites and curves of TLS connections
+// The zero value keeps the Go defaults
+type tlsSettings struct {
+	MinVersion       uint16
+	CipherSuites     []uint16
+	CurvePreferences []tls.CurveID
+}
+
+// parseTLSSettings parses a minimum version such as TLS12, cipher suite names as listed by Go and curve names
+func parseTLSSettings(minVersion string, cipherSuites, curves []string) (tlsSettings, error) {
+	var settings tlsSettings
+	if minVersion != "" {
+		version, ok := tlsVersions[minVersion]
+		if !ok {
+			return settings, fmt.Errorf("unknown TLS version %q, use one of TLS10, TLS11, TLS12 or TLS13", minVersion)
+		}
+		settings.MinVersion = version
+	}
+
+	// Only the suites Go considers secure can be chosen
+	for _, name := range cipherSuites {
+		id, ok := cipherSuiteID(name)
+		if !ok {
+			return settings, fmt.Errorf("unknown or insecure cipher suite %q", name)
+		}
+		settings.CipherSuites = append(settings.CipherSuites, id)
+	}
+
+	for _, name := range curves {
+		curve, ok := tlsCurveIDs[name]
+		if !ok {
+			return settings, fmt.Errorf("unknown curve %q", name)
+		}
+		settings.CurvePreferences = append(settings.CurvePreferences, curve)
+	}
+	return settings, nil
+}
+
+// cipherSuiteID looks up a secure cipher suite by its name
+func cipherSuiteID(name string) (uint16, bool) {
+	for _, suite := range tls.CipherSuites() {
+		if suite.Name == name {
+			return suite.ID, true
+		}
+	}
+	return 0, false
+}
+
+// apply restricts a TLS configuration to the settings, leaving the fields that were not set alone
+// Cipher suites only apply up to TLS 1.2, the TLS 1.3 suites are not configurable
+func (s tlsSettings) apply(config *tls.Config) {
+	if s.MinVersion != 0 {
+		config.MinVersion = s.MinVersion
+	}
+	if len(s.CipherSuites) > 0 {
+		config.CipherSuites = s.CipherSuites
+	}
+	if len(s.CurvePreferences) > 0 {
+		config.CurvePreferences = s.CurvePreferences
+	}
+}
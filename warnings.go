@@ -0,0 +1,131 @@
+package main
+
+import (
+	"log"
+	"sort"
+	"sync"
+
+	"github.com/docker/docker/api/types/swarm"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// parseWarning records an API object missing a field the collector relies on
+type parseWarning struct {
+	Object string `json:"object"`
+	Field  string `json:"field"`
+	ID     string `json:"id"`
+}
+
+// warn records that an API object misses a field, which was given a fallback value
+func (s *scrape) warn(object, field, id string) {
+	s.warnings = append(s.warnings, parseWarning{Object: object, Field: field, ID: id})
+}
+
+// normalizeServices fills in the fields of services that older daemons may omit
+func (s *scrape) normalizeServices(services []swarm.Service) {
+	for i := range services {
+		service := &services[i]
+		if service.Spec.Name == "" {
+			s.warn("service", "Spec.Name", service.ID)
+			service.Spec.Name = service.ID
+		}
+		if service.CreatedAt.IsZero() {
+			s.warn("service", "CreatedAt", service.ID)
+			service.CreatedAt = service.UpdatedAt
+		}
+
+		mode := service.Spec.Mode
+		switch {
+		case mode.Replicated != nil && mode.Replicated.Replicas == nil:
+			// The Docker CLI creates replicated services with a single replica by default
+			s.warn("service", "Spec.Mode.Replicated.Replicas", service.ID)
+			replicas := uint64(1)
+			service.Spec.Mode.Replicated = &swarm.ReplicatedService{Replicas: &replicas}
+		case mode.Replicated == nil && mode.Global == nil && mode.ReplicatedJob == nil && mode.GlobalJob == nil:
+			s.warn("service", "Spec.Mode", service.ID)
+		}
+	}
+}
+
+// normalizeNodes fills in the fields of nodes that older daemons may omit
+func (s *scrape) normalizeNodes(nodes []swarm.Node) {
+	for i := range nodes {
+		node := &nodes[i]
+		if node.Description.Hostname == "" {
+			s.warn("node", "Description.Hostname", node.ID)
+			node.Description.Hostname = node.ID
+		}
+		if node.Status.State == "" {
+			s.warn("node", "Status.State", node.ID)
+			node.Status.State = swarm.NodeStateUnknown
+		}
+		if node.Spec.Role == swarm.NodeRoleManager && node.ManagerStatus == nil {
+			// Count the manager, but not as reachable
+			s.warn("node", "ManagerStatus", node.ID)
+			node.ManagerStatus = &swarm.ManagerStatus{Reachability: swarm.ReachabilityUnknown}
+		}
+	}
+}
+
+// normalizeTasks fills in the fields of tasks that older daemons may omit
+func (s *scrape) normalizeTasks(tasks []swarm.Task) {
+	for i := range tasks {
+		task := &tasks[i]
+		if task.Status.Timestamp.IsZero() {
+			s.warn("task", "Status.Timestamp", task.ID)
+			task.Status.Timestamp = task.UpdatedAt
+			if task.Status.Timestamp.IsZero() {
+				task.Status.Timestamp = task.CreatedAt
+			}
+		}
+	}
+}
+
+// parseWarningKey identifies the missing field counted by docker_exporter_parse_warnings_total
+type parseWarningKey struct {
+	object string
+	field  string
+}
+
+// parseWarningCounter counts the parse warnings of the exposed scrapes
+type parseWarningCounter struct {
+	mu     sync.Mutex
+	counts map[parseWarningKey]uint64
+}
+
+// newParseWarningCounter creates an empty parse warning counter
+func newParseWarningCounter() *parseWarningCounter {
+	return &parseWarningCounter{counts: make(map[parseWarningKey]uint64)}
+}
+
+// add counts the warnings of a scrape, logging every missing field the first time it is seen
+func (p *parseWarningCounter) add(warnings []parseWarning) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, w := range warnings {
+		key := parseWarningKey{object: w.Object, field: w.Field}
+		if _, seen := p.counts[key]; !seen {
+			log.Printf("Docker API returned %s %s without %s, using a fallback value", w.Object, w.ID, w.Field)
+		}
+		p.counts[key]++
+	}
+}
+
+// collect sends the counts of every missing field seen so far
+func (p *parseWarningCounter) collect(ch chan<- prometheus.Metric, d *metricDesc) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	keys := make([]parseWarningKey, 0, len(p.counts))
+	for key := range p.counts {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].object != keys[j].object {
+			return keys[i].object < keys[j].object
+		}
+		return keys[i].field < keys[j].field
+	})
+	for _, key := range keys {
+		d.counter(ch, float64(p.counts[key]), key.object, key.field)
+	}
+}